@@ -0,0 +1,155 @@
+//go:build !noqt
+
+package main
+
+import (
+	"github.com/mappu/miqt/qt6"
+)
+
+// Animation lengths, in milliseconds
+const (
+	slideMs = 150
+	pressMs = 120
+	pulseMs = 300
+	leaveMs = 200
+)
+
+// Animations are what a chip does besides the scheduler's fade. They're nil
+// with reduced motion.
+type Animations struct {
+	// Slides a new chip open along the strip
+	Slide *qt6.QPropertyAnimation
+	// Flashes the background when the repeat count goes up
+	Pulse *qt6.QVariantAnimation
+	// Pushes the contents in for a moment on every press
+	Press *qt6.QVariantAnimation
+	// Fades out a chip leaving without having faded already
+	Leave *qt6.QPropertyAnimation
+	// Called once the chip has left
+	gone func()
+}
+
+func (q *QKey) animate() {
+	if reducedMotion {
+		return
+	}
+
+	slide := "maximumWidth"
+	if orientation.Vertical() {
+		slide = "maximumHeight"
+	}
+	q.Slide = qt6.NewQPropertyAnimation2(q.Widget.QObject, []byte(slide))
+	q.Slide.SetDuration(slideMs)
+	q.Slide.SetEasingCurve(qt6.NewQEasingCurve3(qt6.QEasingCurve__OutCubic))
+	q.Slide.OnFinished(func() {
+		q.Widget.SetFixedSize2(q.Widget.MaximumWidth(), q.Widget.MaximumHeight())
+	})
+
+	q.Pulse = qt6.NewQVariantAnimation()
+	q.Pulse.SetDuration(pulseMs)
+	q.Pulse.SetStartValue(qt6.NewQVariant9(0))
+	q.Pulse.SetKeyValueAt(0.3, qt6.NewQVariant9(0.4))
+	q.Pulse.SetEndValue(qt6.NewQVariant9(0))
+	q.Pulse.OnValueChanged(func(val *qt6.QVariant) {
+		q.restyle(mixHex(q.Base, sakuraRose, val.ToDouble()))
+	})
+
+	q.Press = qt6.NewQVariantAnimation()
+	q.Press.SetDuration(pressMs)
+	q.Press.SetStartValue(qt6.NewQVariant4(0))
+	q.Press.SetKeyValueAt(0.4, qt6.NewQVariant4(2))
+	q.Press.SetEndValue(qt6.NewQVariant4(0))
+	q.Press.OnValueChanged(func(val *qt6.QVariant) {
+		pad := themePadding + val.ToInt()
+		q.Layout.SetContentsMargins(pad, pad, pad, pad)
+	})
+
+	q.Leave = qt6.NewQPropertyAnimation2(q.Opacity.QObject, []byte("opacity"))
+	q.Leave.SetDuration(leaveMs)
+	q.Leave.SetEndValue(qt6.NewQVariant9(0))
+	q.Leave.OnFinished(func() {
+		if gone := q.gone; gone != nil {
+			q.gone = nil
+			gone()
+		}
+	})
+}
+
+func running(anim *qt6.QAbstractAnimation) bool {
+	return anim.State() == qt6.QAbstractAnimation__Running
+}
+
+// resize sets the chip's size, sliding it open when it's new
+func (q *QKey) resize(width, height int, fresh bool) {
+	if q.Slide == nil {
+		q.Widget.SetFixedSize2(width, height)
+		return
+	}
+
+	if fresh {
+		q.Slide.Stop()
+		q.Slide.SetStartValue(qt6.NewQVariant4(0))
+	} else if !running(q.Slide.QAbstractAnimation) {
+		q.Widget.SetFixedSize2(width, height)
+		return
+	}
+
+	// Only the size across the strip is fixed while the chip slides open
+	if orientation.Vertical() {
+		q.Widget.SetFixedWidth(width)
+		q.Widget.SetMinimumHeight(0)
+		q.Slide.SetEndValue(qt6.NewQVariant4(height))
+	} else {
+		q.Widget.SetFixedHeight(height)
+		q.Widget.SetMinimumWidth(0)
+		q.Slide.SetEndValue(qt6.NewQVariant4(width))
+	}
+	if fresh {
+		q.Slide.Start()
+	}
+}
+
+// pressed plays the press effect, and the pulse when the chip was already
+// showing and counted another press
+func (q *QKey) pressed(repeat bool) {
+	if q.Press == nil {
+		return
+	}
+	q.Press.Stop()
+	q.Press.Start()
+	if repeat {
+		q.Pulse.Stop()
+		q.Pulse.Start()
+	}
+}
+
+// leave fades the chip out before calling gone. Reports false if it's
+// already faded or there's no animation, in which case gone isn't called.
+func (q *QKey) leave(gone func()) bool {
+	if q.Leave == nil || q.Opacity.Opacity() < 0.05 {
+		return false
+	}
+	if running(q.Leave.QAbstractAnimation) {
+		return true
+	}
+	q.gone = gone
+	q.Leave.SetStartValue(qt6.NewQVariant9(q.Opacity.Opacity()))
+	q.Leave.Start()
+	return true
+}
+
+// settle stops whatever the chip was doing so it can be reused
+func (q *QKey) settle() {
+	if q.Slide == nil {
+		return
+	}
+	q.gone = nil
+	for _, anim := range []*qt6.QAbstractAnimation{
+		q.Slide.QAbstractAnimation, q.Pulse.QAbstractAnimation,
+		q.Press.QAbstractAnimation, q.Leave.QAbstractAnimation,
+	} {
+		anim.Stop()
+	}
+	q.Layout.SetContentsMargins(themePadding, themePadding, themePadding, themePadding)
+	q.restyle(q.Base)
+}
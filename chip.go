@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Segment is one run of a chip's label sharing a style. Color points at one
+// of the palette variables so every output follows the -iris/-tree/... flags.
+type Segment struct {
+	Text   string
+	Color  *string
+	Bold   bool
+	Italic bool
+	Dim    bool
+}
+
+// Segments breaks the chip's label into styled runs, the same way for every
+// text-based output
+func (key Key) Segments(withCount bool) []Segment {
+	label, shifted := key.Label()
+	if key.Text {
+		return label
+	}
+
+	mods := []Segment{}
+	if key.Held.Meta {
+		mods = append(mods, modSegment(modChar.Meta))
+	}
+	if key.Held.Ctrl {
+		mods = append(mods, modSegment(modChar.Ctrl))
+	}
+	if key.Held.Alt {
+		mods = append(mods, modSegment(modChar.Alt))
+	}
+	if key.Held.Shift && !shifted {
+		mods = append(mods, modSegment(modChar.Shift))
+	}
+
+	ret := append(mods, label...)
+	if withCount && key.Count > 1 {
+		ret = append(ret, Segment{Text: fmt.Sprintf("×%d", key.Count), Color: &sakuraRose, Italic: true})
+	}
+	if key.Action != "" {
+		ret = append(ret, Segment{Text: "(" + key.Action + ")", Italic: true, Dim: true})
+	}
+	return ret
+}
+
+func modSegment(char string) Segment {
+	return Segment{Text: char, Color: &sakuraLove, Bold: true}
+}
+
+// Label is the chip's label without modifiers, count or action, restyled
+// by the -style rules. Reports whether shift was folded into the label so it
+// needn't be shown separately.
+func (key Key) Label() ([]Segment, bool) {
+	if key.Text {
+		return key.baseLabel()
+	}
+
+	style := key.Style()
+	if style.Icon != "" {
+		return []Segment{{Text: style.Icon, Color: style.Color, Bold: true}}, false
+	}
+	segs, shifted := key.baseLabel()
+	if style.Color != nil {
+		for i := range segs {
+			// The side markers keep telling left and right apart
+			if segs[i].Text != leftChar && segs[i].Text != rightChar {
+				segs[i].Color = style.Color
+			}
+		}
+	}
+	return segs, shifted
+}
+
+func (key Key) baseLabel() ([]Segment, bool) {
+	if key.Text {
+		ret := []Segment{{Text: key.Char, Bold: true}}
+		if key.Open {
+			ret = append(ret, Segment{Text: "▏", Color: &sakuraGold, Bold: true})
+		}
+		return ret, false
+	}
+
+	sub := key.Char
+	r, sz := utf8.DecodeRuneInString(sub + ".")
+	if !key.Found {
+		return []Segment{{Text: fmt.Sprintf("<%d: %s>", key.Code, key.Name), Color: &sakuraTree, Bold: true}}, false
+	} else if utf8.RuneCountInString(key.Char) > 1 && r < 255 {
+		return []Segment{{Text: sub, Bold: true}}, false
+	} else if r == leftCharRune {
+		return []Segment{
+			{Text: leftChar, Color: &sakuraGold, Bold: true},
+			{Text: sub[sz:], Color: &sakuraIris, Bold: true},
+		}, false
+	} else if r > 255 {
+		r, sz = utf8.DecodeLastRuneInString(sub)
+		if r == rightCharRune {
+			return []Segment{
+				{Text: sub[:len(sub)-sz], Color: &sakuraIris, Bold: true},
+				{Text: rightChar, Color: &sakuraGold, Bold: true},
+			}, false
+		}
+		return []Segment{{Text: sub, Color: &sakuraIris, Bold: true}}, false
+	}
+
+	plain := strings.ToLower(sub)
+	if shift, exist := shifts[plain]; key.Held.Shift && exist {
+		return []Segment{{Text: shift}}, true
+	}
+	return []Segment{{Text: plain}}, false
+}
+
+func segmentsText(segs []Segment) string {
+	ret := ""
+	for _, seg := range segs {
+		ret += seg.Text
+	}
+	return ret
+}
+
+// fitChips joins as many of the newest chips as fit in the width, newest on
+// the right. format returns the rendered chip along with its visible width.
+func fitChips(snap []Key, width int, sep string, format func(Key) (string, int)) (string, int) {
+	chips, l := fitChipList(snap, width, visibleWidth(sep), format)
+	slices.Reverse(chips)
+	return strings.Join(chips, sep), l
+}
+
+// fitChipList is fitChips without the joining, newest first
+func fitChipList(snap []Key, width int, sepWidth int, format func(Key) (string, int)) ([]string, int) {
+	chips := []string{}
+	l := 0
+	for i := len(snap) - 1; i >= 0; i-- {
+		key := snap[i]
+		if key.Char == "\x00" {
+			continue
+		}
+
+		chip, n := format(key)
+		new_l := n
+		if len(chips) > 0 {
+			new_l = n + sepWidth + l
+		}
+		if new_l >= width {
+			break
+		}
+		chips = append(chips, chip)
+		l = new_l
+	}
+	return chips, l
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type ColorMode int
+
+const (
+	ColorNone ColorMode = iota
+	Color16
+	Color256
+	ColorTrue
+)
+
+var colorModes = map[string]ColorMode{
+	"none":      ColorNone,
+	"16":        Color16,
+	"256":       Color256,
+	"truecolor": ColorTrue,
+}
+
+var (
+	colorMode   = detectColorMode()
+	termChipBg  bool
+	_flagChipBg *bool
+)
+
+func detectColorMode() ColorMode {
+	if os.Getenv("NO_COLOR") != "" {
+		return ColorNone
+	}
+
+	colorterm := strings.ToLower(os.Getenv("COLORTERM"))
+	if colorterm == "truecolor" || colorterm == "24bit" {
+		return ColorTrue
+	}
+
+	env := os.Getenv("TERM")
+	switch {
+	case env == "dumb":
+		return ColorNone
+	case strings.Contains(env, "direct"):
+		return ColorTrue
+	case strings.Contains(env, "256"):
+		return Color256
+	}
+	return Color16
+}
+
+func applyColorMode(val string) error {
+	val = strings.ToLower(val)
+	if val == "auto" {
+		colorMode = detectColorMode()
+		return nil
+	}
+
+	mode, ok := colorModes[val]
+	if !ok {
+		return fmt.Errorf("color mode `%s' doesn't exist (auto, truecolor, 256, 16, none)", val)
+	}
+	colorMode = mode
+	return nil
+}
+
+func parseHex(hex string) (int, int, int) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil {
+		return 0, 0, 0
+	}
+	return int(n >> 16 & 0xff), int(n >> 8 & 0xff), int(n & 0xff)
+}
+
+// ansiColor returns the SGR parameters for a hex color in the current color
+// mode, or "" when colors are off
+func ansiColor(hex string, bg bool) string {
+	r, g, b := parseHex(hex)
+	switch colorMode {
+	case ColorTrue:
+		if bg {
+			return fmt.Sprintf("48;2;%d;%d;%d", r, g, b)
+		}
+		return fmt.Sprintf("38;2;%d;%d;%d", r, g, b)
+	case Color256:
+		if bg {
+			return fmt.Sprintf("48;5;%d", xterm256(r, g, b))
+		}
+		return fmt.Sprintf("38;5;%d", xterm256(r, g, b))
+	case Color16:
+		code := xterm16(r, g, b)
+		if bg {
+			code += 10
+		}
+		return strconv.Itoa(code)
+	}
+	return ""
+}
+
+func xterm256(r, g, b int) int {
+	levels := []int{0, 95, 135, 175, 215, 255}
+	nearest := func(c int) int {
+		best := 0
+		for i, level := range levels {
+			if abs(c-level) < abs(c-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	cr, cg, cb := nearest(r), nearest(g), nearest(b)
+	cube := 16 + 36*cr + 6*cg + cb
+	cubeDist := sq(r-levels[cr]) + sq(g-levels[cg]) + sq(b-levels[cb])
+
+	gray := min(23, max(0, ((r+g+b)/3-8+5)/10))
+	level := 8 + 10*gray
+	grayDist := sq(r-level) + sq(g-level) + sq(b-level)
+	if grayDist < cubeDist {
+		return 232 + gray
+	}
+	return cube
+}
+
+// xterm16 picks by hue rather than by distance, since the 16 colors are so
+// far apart that pastel colors would otherwise all turn gray
+func xterm16(r, g, b int) int {
+	hi := max(r, g, b)
+	lo := min(r, g, b)
+	light := float64(hi+lo) / 510
+
+	if hi == 0 || float64(hi-lo)/float64(hi) < 0.25 {
+		switch {
+		case light > 0.75:
+			return 97
+		case light > 0.5:
+			return 37
+		case light > 0.25:
+			return 90
+		}
+		return 30
+	}
+
+	var hue float64
+	delta := float64(hi - lo)
+	switch hi {
+	case r:
+		hue = 60 * float64(g-b) / delta
+	case g:
+		hue = 60*float64(b-r)/delta + 120
+	default:
+		hue = 60*float64(r-g)/delta + 240
+	}
+	hue = math.Mod(hue+360, 360)
+
+	// red, yellow, green, cyan, blue, magenta
+	codes := []int{1, 3, 2, 6, 4, 5}
+	code := codes[int(math.Ceil(hue/60-0.5))%6]
+	if light < 0.25 {
+		return 30 + code
+	}
+	return 90 + code
+}
+
+// mixHex blends from one hex color to the other
+func mixHex(from, to string, t float64) string {
+	r1, g1, b1 := parseHex(from)
+	r2, g2, b2 := parseHex(to)
+	mix := func(a, b int) int {
+		return a + int(float64(b-a)*t)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", mix(r1, r2), mix(g1, g2), mix(b1, b2))
+}
+
+// contrastColor picks black or white text for the background
+func contrastColor(hex string) string {
+	r, g, b := parseHex(hex)
+	if 0.299*float64(r)+0.587*float64(g)+0.114*float64(b) > 128 {
+		return "#000000"
+	}
+	return "#ffffff"
+}
+
+func abs(n int) int {
+	return max(n, -n)
+}
+
+func sq(n int) int {
+	return n * n
+}
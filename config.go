@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// The config file sets flags before the command line does, one per line the
+// way they're given there, eg `iris = #696ac2' or `evt- = KEY_A'. Theme keys
+// like `radius = 8' work too.
+func configPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := userHome()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kbviz", "config")
+}
+
+// Event filters before the config file or flags change them, so the config
+// only needs to hold the differences
+var (
+	builtinClasses map[evdev.EvType]bool
+	builtinIgnores map[evdev.EvType]map[evdev.EvCode]bool
+)
+
+func loadConfig() error {
+	builtinClasses = maps.Clone(classes)
+	builtinIgnores = map[evdev.EvType]map[evdev.EvCode]bool{}
+	for t, codes := range ignoreEvt {
+		builtinIgnores[t] = maps.Clone(codes)
+	}
+
+	data, err := os.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: not in the form name = value", i+1)
+		}
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+
+		if flag.Lookup(name) != nil {
+			err = flag.Set(name, val)
+		} else {
+			err = loadTheme(name + ": " + val)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %w", i+1, name, err)
+		}
+	}
+	return nil
+}
+
+// saveConfig replaces the lines setting any of the names with the new
+// ones, keeping everything else in the file as it was
+func saveConfig(names []string, lines []string) error {
+	path := configPath()
+	if path == "" {
+		return fmt.Errorf("nowhere to save the config")
+	}
+
+	kept := []string{}
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			name, _, _ := strings.Cut(line, "=")
+			if !slices.Contains(names, strings.TrimSpace(name)) {
+				kept = append(kept, line)
+			}
+		}
+	}
+
+	return writeUserFile(path, []byte(strings.Join(append(kept, lines...), "\n")+"\n"))
+}
+
+// filterConfig is the config lines taking the event filters from the
+// built-in ones to the current ones
+func filterConfig() []string {
+	lines := []string{}
+	for _, t := range slices.Sorted(maps.Keys(evdev.EVToString)) {
+		if classes[t] != builtinClasses[t] {
+			sign := "-"
+			if classes[t] {
+				sign = "+"
+			}
+			lines = append(lines, fmt.Sprintf("cls%s = %s", sign, evdev.EVToString[t]))
+		}
+	}
+
+	for _, t := range slices.Sorted(maps.Keys(evdev.EVToString)) {
+		codes := map[evdev.EvCode]bool{}
+		maps.Copy(codes, ignoreEvt[t])
+		maps.Copy(codes, builtinIgnores[t])
+		for _, code := range slices.Sorted(maps.Keys(codes)) {
+			if ignoreEvt[t][code] == builtinIgnores[t][code] {
+				continue
+			}
+			sign := "+"
+			if ignoreEvt[t][code] {
+				sign = "-"
+			}
+			lines = append(lines, fmt.Sprintf("evt%s = %s", sign, evdev.CodeName(t, code)))
+		}
+	}
+	return lines
+}
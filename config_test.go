@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := configPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("# mine\nradius = 8\niris = #000000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveConfig([]string{"iris", "timeout"}, []string{"iris = #ffffff", "timeout = 3"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# mine\nradius = 8\niris = #ffffff\ntimeout = 3\n"
+	if string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+}
+
+func TestSaveConfigNew(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(t.TempDir(), "missing"))
+	if err := saveConfig([]string{"bg"}, []string{"bg = #101010"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "bg = #101010\n" {
+		t.Errorf("saved %q", data)
+	}
+}
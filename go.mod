@@ -3,8 +3,11 @@ module kbviz
 go 1.24.3
 
 require (
-	github.com/holoplot/go-evdev v0.0.0-20240306072622-217e18f17db1 // indirect
-	github.com/mappu/miqt v0.10.0 // indirect
-	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
+	github.com/holoplot/go-evdev v0.0.0-20240306072622-217e18f17db1
+	github.com/mappu/miqt v0.10.0
+	golang.org/x/image v0.27.0
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
 )
+
+require golang.org/x/text v0.25.0 // indirect
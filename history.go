@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+type MergePolicy int
+
+const (
+	MergeSearch MergePolicy = iota
+	MergeAdjacent
+	MergeWindow
+	MergeNever
+)
+
+var mergePolicies = map[string]MergePolicy{
+	"search":   MergeSearch,
+	"adjacent": MergeAdjacent,
+	"window":   MergeWindow,
+	"never":    MergeNever,
+}
+
+var (
+	mergePolicy    = MergeSearch
+	mergeWindow    = time.Second
+	mergeMaxCount  = 0
+	_flagMaxCount  *uint
+	_flagMergeTime *time.Duration
+)
+
+func applyMerge(val string) error {
+	policy, ok := mergePolicies[strings.ToLower(val)]
+	if !ok {
+		return fmt.Errorf("merge policy `%s' doesn't exist (search, adjacent, window, never)", val)
+	}
+	mergePolicy = policy
+	return nil
+}
+
+// mergeTarget finds the chip the key would be merged into, or -1
+func mergeTarget(history *Ring[*Key], key *Key) int {
+	if mergePolicy == MergeNever || history.Len() == 0 {
+		return -1
+	}
+
+	i := history.Len() - 1
+	if mergePolicy == MergeSearch {
+		for i >= 0 && history.At(i).Type != key.Type {
+			i--
+		}
+		if i < 0 {
+			return -1
+		}
+	}
+
+	last := history.At(i)
+	switch {
+	case !last.Equals(*key), last.Text:
+		return -1
+	case mergeMaxCount > 0 && last.Count >= mergeMaxCount:
+		return -1
+	case mergePolicy == MergeWindow && key.Time.Sub(last.Time) > mergeWindow:
+		return -1
+	}
+	return i
+}
+
+// mergeKey adds the key to the history, bumping the count of a previous
+// chip instead when the merge policy allows it. Returns the chip that now
+// holds the key.
+func mergeKey(history *Ring[*Key], key *Key) *Key {
+	i := mergeTarget(history, key)
+	if i < 0 {
+		history.Push(key)
+		return key
+	}
+
+	last := history.At(i)
+	last.Count = last.Count + 1
+	last.Time = key.Time
+	last.Repeat = key.Repeat
+	// Move event to front of list
+	if i < history.Len()-1 {
+		history.Remove(i)
+		history.Push(last)
+	}
+	return last
+}
+
+var (
+	defaultTTL   = 5 * time.Second
+	defaultFade  = 500 * time.Millisecond
+	maxChips     = 0
+	_flagHistory *uint
+	classTTL     = map[evdev.EvType]time.Duration{}
+	classFade    = map[evdev.EvType]time.Duration{}
+	_flagChips   *uint
+)
+
+func applyDuration(def *time.Duration, perClass map[evdev.EvType]time.Duration) func(val string) error {
+	return func(val string) error {
+		parts := strings.SplitN(val, "=", 2)
+		dur, err := time.ParseDuration(parts[len(parts)-1])
+		if err != nil {
+			return err
+		}
+
+		if len(parts) == 1 {
+			if def == nil {
+				return fmt.Errorf("not in proper format (eg EV_REL=1s)")
+			}
+			*def = dur
+			return nil
+		}
+
+		t, err := evclass(parts[0])
+		if err == nil {
+			perClass[t] = dur
+		}
+		return err
+	}
+}
+
+func (key *Key) TTL() time.Duration {
+	if ttl, ok := classTTL[key.Type]; ok {
+		return ttl
+	}
+	return defaultTTL
+}
+
+func (key *Key) Fade() time.Duration {
+	if fade, ok := classFade[key.Type]; ok {
+		return fade
+	}
+	return defaultFade
+}
+
+func (key *Key) Expiry() time.Time {
+	return key.Time.Add(key.TTL())
+}
+
+// Opacity ramps from 1 to 0 over the fade duration leading up to expiry
+func (key *Key) Opacity(now time.Time) float64 {
+	if key.TTL() <= 0 {
+		return 1
+	}
+
+	left := key.Expiry().Sub(now)
+	fade := min(key.Fade(), key.TTL())
+	if left >= fade {
+		return 1
+	} else if left <= 0 {
+		return 0
+	}
+	return float64(left) / float64(fade)
+}
+
+// expireHistory drops chips past their time-to-live and any beyond the
+// maximum chip count. Returns whether anything changed on screen, which
+// includes chips that are still fading out. Must be called with historyMu
+// held.
+func expireHistory(now time.Time) bool {
+	changed := false
+	expired := history.Filter(func(key *Key) bool {
+		if key.TTL() > 0 && !now.Before(key.Expiry()) {
+			return false
+		}
+		if key.Opacity(now) < 1 {
+			changed = true
+		}
+		return true
+	})
+	if len(expired) > 0 {
+		changed = true
+	}
+
+	for maxChips > 0 && history.Len() > maxChips {
+		history.Remove(0)
+		changed = true
+	}
+
+	return changed
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// Chips are timed against a fixed start instead of the wall clock
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func testKey(t evdev.EvType, code evdev.EvCode, ms int) *Key {
+	return &Key{ID: nextKeyID(), Type: t, Code: code, Name: evdev.CodeName(t, code), Count: 1, Time: at(ms)}
+}
+
+// chipCounts describes the history as name:count pairs, oldest first
+func chipCounts(history *Ring[*Key]) []string {
+	chips := []string{}
+	for i := range history.Len() {
+		key := history.At(i)
+		chips = append(chips, fmt.Sprintf("%s:%d", key.Name, key.Count))
+	}
+	return chips
+}
+
+func TestMergeKey(t *testing.T) {
+	a := func(ms int) *Key { return testKey(evdev.EV_KEY, evdev.KEY_A, ms) }
+	b := func(ms int) *Key { return testKey(evdev.EV_KEY, evdev.KEY_B, ms) }
+	x := func(ms int) *Key { return testKey(evdev.EV_REL, evdev.REL_X, ms) }
+
+	for _, tt := range []struct {
+		name     string
+		policy   MergePolicy
+		maxCount int
+		keys     []*Key
+		want     []string
+	}{
+		{"search repeats", MergeSearch, 0, []*Key{a(0), a(10), a(20)}, []string{"KEY_A:3"}},
+		{"search skips other classes", MergeSearch, 0, []*Key{a(0), x(10), a(20)}, []string{"REL_X:1", "KEY_A:2"}},
+		{"search stops at the same class", MergeSearch, 0, []*Key{a(0), b(10), a(20)}, []string{"KEY_A:1", "KEY_B:1", "KEY_A:1"}},
+		{"adjacent", MergeAdjacent, 0, []*Key{a(0), x(10), a(20)}, []string{"KEY_A:1", "REL_X:1", "KEY_A:1"}},
+		{"window inside", MergeWindow, 0, []*Key{a(0), a(1000)}, []string{"KEY_A:2"}},
+		{"window outside", MergeWindow, 0, []*Key{a(0), a(1001)}, []string{"KEY_A:1", "KEY_A:1"}},
+		{"window from the last press", MergeWindow, 0, []*Key{a(0), a(900), a(1800)}, []string{"KEY_A:3"}},
+		{"never", MergeNever, 0, []*Key{a(0), a(10)}, []string{"KEY_A:1", "KEY_A:1"}},
+		{"max count", MergeSearch, 2, []*Key{a(0), a(10), a(20)}, []string{"KEY_A:2", "KEY_A:1"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			oldPolicy, oldMax := mergePolicy, mergeMaxCount
+			mergePolicy, mergeMaxCount = tt.policy, tt.maxCount
+			t.Cleanup(func() { mergePolicy, mergeMaxCount = oldPolicy, oldMax })
+
+			history := NewRing[*Key](8)
+			for _, key := range tt.keys {
+				chip := mergeKey(history, key)
+				if !chip.Time.Equal(key.Time) {
+					t.Errorf("merged chip at %v, want %v", chip.Time, key.Time)
+				}
+			}
+			if got := chipCounts(history); !slices.Equal(got, tt.want) {
+				t.Errorf("chips %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Text chips keep what was typed, so presses never merge into them
+	history := NewRing[*Key](8)
+	text := a(0)
+	text.Text = true
+	history.Push(text)
+	if i := mergeTarget(history, a(10)); i != -1 {
+		t.Errorf("merged into text chip %d", i)
+	}
+}
+
+func TestExpireHistory(t *testing.T) {
+	oldHistory, oldTTL, oldFade, oldMax := history, defaultTTL, defaultFade, maxChips
+	oldClassTTL := classTTL
+	t.Cleanup(func() {
+		history, defaultTTL, defaultFade, maxChips = oldHistory, oldTTL, oldFade, oldMax
+		classTTL = oldClassTTL
+	})
+	defaultTTL, defaultFade = time.Second, 200*time.Millisecond
+
+	for _, tt := range []struct {
+		name     string
+		maxChips int
+		classTTL map[evdev.EvType]time.Duration
+		keys     []*Key
+		now      int
+		changed  bool
+		want     []string
+	}{
+		{"fresh", 0, nil, []*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0)}, 500, false, []string{"KEY_A:1"}},
+		{"fading", 0, nil, []*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0)}, 900, true, []string{"KEY_A:1"}},
+		{"expired", 0, nil, []*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0)}, 1000, true, []string{}},
+		{
+			"only the old ones expire", 0, nil,
+			[]*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0), testKey(evdev.EV_KEY, evdev.KEY_B, 600)},
+			1100, true, []string{"KEY_B:1"},
+		},
+		{
+			"per class", 0, map[evdev.EvType]time.Duration{evdev.EV_REL: 100 * time.Millisecond},
+			[]*Key{testKey(evdev.EV_REL, evdev.REL_X, 0), testKey(evdev.EV_KEY, evdev.KEY_A, 0)},
+			500, true, []string{"KEY_A:1"},
+		},
+		{
+			"never expires", 0, map[evdev.EvType]time.Duration{evdev.EV_KEY: 0},
+			[]*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0)},
+			3600000, false, []string{"KEY_A:1"},
+		},
+		{
+			"max chips", 2, nil,
+			[]*Key{testKey(evdev.EV_KEY, evdev.KEY_A, 0), testKey(evdev.EV_KEY, evdev.KEY_B, 0), testKey(evdev.EV_KEY, evdev.KEY_C, 0)},
+			0, true, []string{"KEY_B:1", "KEY_C:1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			maxChips = tt.maxChips
+			classTTL = tt.classTTL
+			if classTTL == nil {
+				classTTL = map[evdev.EvType]time.Duration{}
+			}
+			history = NewRing[*Key](8)
+			for _, key := range tt.keys {
+				history.Push(key)
+			}
+
+			if changed := expireHistory(at(tt.now)); changed != tt.changed {
+				t.Errorf("changed %v, want %v", changed, tt.changed)
+			}
+			if got := chipCounts(history); !slices.Equal(got, tt.want) {
+				t.Errorf("chips %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
-	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode/utf8"
@@ -18,8 +19,6 @@ import (
 	"golang.org/x/term"
 
 	"github.com/holoplot/go-evdev"
-	"github.com/mappu/miqt/qt6"
-	"github.com/mappu/miqt/qt6/mainthread"
 )
 
 func escalate() {
@@ -56,18 +55,10 @@ func escalate() {
 }
 
 var (
-	history         []*Key
+	history         = NewRing[*Key](1024)
 	historyMu       sync.Mutex
-	kblist          *qt6.QHBoxLayout
-	kblistMu        *qt6.QHBoxLayout
-	label           *qt6.QLabel
-	labelMu         sync.Mutex
-	kb2             *qt6.QScrollArea
-	font            *qt6.QFont
-	win             *qt6.QWidget
-	app             *qt6.QApplication
-	keyTime         time.Time
 	_flagFontFamily *string
+	_flagTray       *bool
 )
 
 var (
@@ -79,6 +70,12 @@ var (
 	sakuraBg   = "#f2e1ea"
 )
 
+// The settings window changes the filters while events come in
+var filterMu sync.RWMutex
+
+// Set from the tray to stop showing keys for a while
+var capturePaused atomic.Bool
+
 var ignoreEvt = map[evdev.EvType]map[evdev.EvCode]bool{
 	evdev.EV_KEY: {
 		evdev.BTN_TOOL_FINGER:    true,
@@ -167,31 +164,36 @@ func applyEvent(set bool) func(val string) error {
 		return err
 	}
 }
-func applyClass(set bool) func(val string) error {
-	return func(val string) error {
-		val = strings.ToUpper(val)
-		try, err := strconv.Atoi(val)
-		if err == nil {
-			code := evdev.EvType(try)
-			_, ok := evdev.EVToString[code]
-			if !ok {
-				return fmt.Errorf("class `%d' doesn't exist", code)
-			}
-			classes[code] = set
-			return nil
+func evclass(val string) (evdev.EvType, error) {
+	val = strings.ToUpper(val)
+	try, err := strconv.Atoi(val)
+	if err == nil {
+		code := evdev.EvType(try)
+		_, ok := evdev.EVToString[code]
+		if !ok {
+			return 0, fmt.Errorf("class `%d' doesn't exist", code)
 		}
+		return code, nil
+	}
 
-		if !strings.HasPrefix(val, "EV_") {
-			val = "EV_" + val
-		}
+	if !strings.HasPrefix(val, "EV_") {
+		val = "EV_" + val
+	}
 
-		t, ok := evdev.EVFromString[val]
-		if !ok {
-			return fmt.Errorf("class `%s' doesn't exist", val)
-		}
+	t, ok := evdev.EVFromString[val]
+	if !ok {
+		return 0, fmt.Errorf("class `%s' doesn't exist", val)
+	}
+	return t, nil
+}
 
-		classes[t] = set
-		return nil
+func applyClass(set bool) func(val string) error {
+	return func(val string) error {
+		t, err := evclass(val)
+		if err == nil {
+			classes[t] = set
+		}
+		return err
 	}
 }
 
@@ -204,13 +206,37 @@ func main() {
 	devs := grabKeyboards()
 
 	_flagGui := flag.Bool("gui", false, "Enable GUI")
+	flag.Func("format", "Output format: term, tui, keyboard, jsonl, waybar, i3bar, polybar, tmux", applyFormat)
+	_flagWidth = flag.Uint("width", uint(statusWidth), "Columns available to status bar formats")
+	_flagAltScreen = flag.Bool("altscreen", false, "Draw the terminal output on the alternate screen")
+	_flagKeycaps = flag.Bool("keycaps", false, "Draw boxed keycaps in the terminal instead of a line of glyphs")
+	_flagRows = flag.Uint("rows", uint(termRows), "Rows of keycaps in the terminal")
+	flag.Func("graphics", "Draw keycap images in the terminal: auto, kitty, sixel, none", applyGraphics)
+	flag.Func("glyph-width", "Columns a glyph takes up: ambiguous=N, private=N, U+XXXX=N or U+XXXX-U+YYYY=N", applyGlyphWidth)
+	flag.Func("color", "Terminal colors: auto, truecolor, 256, 16, none (auto honors NO_COLOR)", applyColorMode)
+	_flagChipBg = flag.Bool("chip-bg", false, "Draw terminal chips on the 'bg' color")
 	_flagFontFamily = flag.String("font", "", "Set the font family")
+	flag.Func("orientation", "Strip direction from the newest chip: rtl, ltr, ttb, btt", applyOrientation)
+	flag.Func("keyboard", "Keyboard diagram layout: ansi, iso, ortho or a keyboard-layout-editor.com JSON file", applyKeyboard)
+	_flagOverlay = flag.Bool("overlay", false, "Frameless, always-on-top window with a see-through background")
+	_flagClickThrough = flag.Bool("click-through", false, "Let clicks pass through the overlay window")
+	_flagTray = flag.Bool("tray", true, "Show a tray icon to pause, clear, switch themes and quit")
+	flag.Func("anchor", "Pin the window to a screen corner or edge, eg top-right or bottom", applyAnchor)
+	_flagMargin = flag.Uint("margin", uint(anchorMargin), "Pixels between the anchored window and the screen edge")
+	_flagScreen = flag.String("screen", "", "Screen to anchor the window on, by index or name")
+	_flagReduceMotion = flag.Bool("reduce-motion", false, "Turn off chip animations (also follows the GNOME and KDE animation settings)")
+	flag.Func("theme", "Theme: light, dark, high-contrast, or a theme file or base16/base24 scheme (color flags after it override it)", applyTheme)
 	flag.Func("iris", "Set the color 'iris'", applyColor(&sakuraIris))
 	flag.Func("tree", "Set the color 'tree'", applyColor(&sakuraTree))
 	flag.Func("rose", "Set the color 'rose'", applyColor(&sakuraRose))
 	flag.Func("gold", "Set the color 'gold'", applyColor(&sakuraGold))
-	flag.Func("love", "Set the color 'rose'", applyColor(&sakuraLove))
+	flag.Func("love", "Set the color 'love'", applyColor(&sakuraLove))
 	flag.Func("bg", "Set the color 'bg'", applyColor(&sakuraBg))
+	flag.Func("style", "Restyle matching chips, eg 'name KEY_F* and modifiers include ctrl: color=#d87576 bg=#000000 icon=Fn width=2' (selectors: modifiers include, class, device matches, name)", applyStyle)
+	flag.Func("slot", "Template for a chip slot, eg 'code={{.Device}}' (slots: code, count, label, bulbs)", applySlot)
+	_flagHideHeader = flag.Bool("hide-header", false, "Hide the code and count row of the chips")
+	_flagHideFooter = flag.Bool("hide-footer", false, "Hide the modifier row of the chips")
+	flag.Func("template", "Template for terminal chips, eg '{{.Mods}}{{.Label}} {{.Hold}}' (fields: Label, Mods, Count, Code, Scancode, Name, Device, Mode, Action, Time, Hold)", applyTemplate)
 	flag.Func("evt-", "Ignore this event", applyEvent(true))
 	flag.Func("evt+", "Listen to this event", applyEvent(false))
 	flag.Func("S", "Set a symbol in the format of <key>=<char> eg KEY_NUM_8=8", func(val string) error {
@@ -230,166 +256,94 @@ func main() {
 	})
 	flag.Func("cls-", "Ignore an event class (eg EV_KEY)", applyClass(false))
 	flag.Func("cls+", "Listen to an event class (eg EV_KEY)", applyClass(true))
-	_flagTimeout := flag.Uint("timeout", 5, "Time before clearing the output")
-
+	_flagTimeout := flag.Uint("timeout", 5, "Seconds before a chip expires (0 keeps chips forever)")
+	flag.Func("ttl", "Set the time before chips of a class expire (eg EV_REL=1s)", applyDuration(nil, classTTL))
+	flag.Func("fade", "Set the fade-out time, optionally for one class (eg 500ms or EV_KEY=1s)", applyDuration(&defaultFade, classFade))
+	_flagChips = flag.Uint("max-chips", 0, "Maximum number of visible chips (0 is unlimited)")
+	_flagHistory = flag.Uint("history", uint(history.Cap()), "Number of chips kept in history")
+	_flagFPS = flag.Uint("fps", uint(maxFPS), "Maximum redraws per second")
+	_flagNvim = flag.String("nvim", "", "Neovim RPC socket to read the mode and mappings from (default $NVIM)")
+	_flagText = flag.Bool("text", false, "Group consecutive printable keys into a single text chip")
+	flag.Func("merge", "How repeated keys are merged: search (last chip of the same class), adjacent, window, never", applyMerge)
+	_flagMergeTime = flag.Duration("merge-window", mergeWindow, "Maximum time between presses for -merge window")
+	_flagMaxCount = flag.Uint("max-count", 0, "Start a new chip once a chip reaches this count (0 is unlimited)")
+
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "config: \x1b[91;1m%s\x1b[0m\n", err.Error())
+	}
 	flag.Parse()
+	textMode = *_flagText
+	mergeWindow = *_flagMergeTime
+	mergeMaxCount = int(*_flagMaxCount)
+	defaultTTL = time.Duration(*_flagTimeout) * time.Second
+	maxChips = int(*_flagChips)
+	history = NewRing[*Key](int(*_flagHistory))
+	maxFPS = int(*_flagFPS)
+	statusWidth = int(*_flagWidth)
+	termAltScreen = *_flagAltScreen
+	termKeycaps = *_flagKeycaps
+	termRows = max(1, int(*_flagRows))
+	termChipBg = *_flagChipBg
+	overlayMode = *_flagOverlay
+	clickThrough = *_flagClickThrough
+	anchorMargin = int(*_flagMargin)
+	targetScreen = *_flagScreen
+	reducedMotion = *_flagReduceMotion
+	hideHeader = *_flagHideHeader
+	hideFooter = *_flagHideFooter
+	connectNvim()
+
+	if _, ok := renderer.(*KeyboardRenderer); ok && keyboard == nil {
+		applyKeyboard("ansi")
+	}
 
 	doGUI := !term.IsTerminal(0)
 	if _flagGui != nil {
 		doGUI = *_flagGui
 	}
 
-	done := make(chan bool)
-	for _, dev := range devs {
-		go listen(done, dev)
-	}
-
-	keyTime = time.Now()
-	timeout := time.Duration(1000 * 1000 * 1000 * (*_flagTimeout))
-	go func() {
-		for true {
-			if time.Since(keyTime) >= timeout {
-				historyMu.Lock()
-				history = []*Key{}
-				historyMu.Unlock()
-				PrintHistory()
-			}
-			time.Sleep(time.Duration(1000 * 1000 * 500))
-		}
-	}()
-
+	var gui *QtRenderer
 	if doGUI {
-		makeGUI()
-	} else {
-		PrintHistory()
+		var err error
+		gui, err = NewQtRenderer()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gui: \x1b[91;1m%s\x1b[0m\n", err.Error())
+			os.Exit(1)
+		}
+		renderer = gui
 	}
 
-	<-done
-}
+	if lc, ok := renderer.(Lifecycle); ok {
+		err := lc.Start()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "output: \x1b[91;1m%s\x1b[0m\n", err.Error())
+		}
+		defer lc.Stop()
 
-func recursiveClear(layout *qt6.QLayout) {
-	if layout == nil {
-		return
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			sig := <-quit
+			lc.Stop()
+			// Exit the way the shell reports a process killed by the signal
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		}()
 	}
 
-	for layout.Count() > 0 {
-		item := layout.TakeAt(0)
-		if childLayout := item.Layout(); childLayout != nil {
-			recursiveClear(childLayout)
-			childLayout.DeleteLater()
-		}
-		if childWidget := item.Widget(); childWidget != nil {
-			childWidget.DeleteLater()
-		}
-		item.Delete()
+	done := make(chan bool)
+	for _, dev := range devs {
+		go listen(done, dev)
 	}
-}
 
-func scaleLabel(_ *qt6.QSize) {
-	labelMu.Lock()
-	defer labelMu.Unlock()
+	go schedule()
 
-	PrintHistory()
-}
-
-type Sizes struct {
-	Max *uint
-	Min *uint
-	Fix *uint
-}
-
-func makeGUI() {
-	fmt.Println("gui")
-	app = qt6.NewQApplication(os.Args)
-	defer qt6.QApplication_Exec()
-
-	win = qt6.NewQWidget(nil)
-	win.SetWindowTitle("KbViz")
-	ico := qt6.QIcon_FromTheme("ktouch")
-	win.SetWindowIcon(ico)
-	win.SetFixedSize2(640, 40)
-
-	if _flagFontFamily == nil || *_flagFontFamily == "" {
-		font = qt6.QFontDatabase_SystemFont(qt6.QFontDatabase__GeneralFont)
+	if gui != nil {
+		gui.Run()
 	} else {
-		font = qt6.NewQFont2(*_flagFontFamily)
+		Redraw()
 	}
 
-	label = qt6.NewQLabel(nil)
-	label.SetMinimumSize2(1, 1)
-	label.SetAlignment(qt6.AlignRight)
-	label.SetFont(font)
-
-	// kblist = qt6.NewQHBoxLayout(nil)
-	// kblist.SetContentsMargins(4, 4, 4, 4)
-	// layout.SetDirection(qt6.QBoxLayout__RightToLeft)
-	// layout.AddWidget3(label.QWidget, 0, qt6.AlignRight)
-
-	win.SetLayoutDirection(qt6.RightToLeft)
-	win.SetContentsMargins(0, 0, 0, 0)
-	/*
-		scrollarea = QScrollArea(parent.widget())
-		layout = QVBoxLayout(scrollarea)
-		realmScroll.setWidget(layout.widget())
-
-		layout.addWidget(QLabel("Test"))
-	*/
-
-	container := qt6.NewQWidget(nil)
-	kblist = qt6.NewQHBoxLayout(container)
-	kblist.SetDirection(qt6.QBoxLayout__RightToLeft)
-	kblist.SetContentsMargins(0, 0, 0, 0)
-	kblist.SetSpacing(4)
-
-	kb2 = qt6.NewQScrollArea(nil)
-	kb2.SetWidget(container)
-	kb2.SetWidgetResizable(true)
-	kb2.SetHorizontalScrollBarPolicy(qt6.ScrollBarAlwaysOff)
-
-	scroller := qt6.NewQVBoxLayout(win)
-	scroller.SetContentsMargins(0, 0, 0, 0)
-	scroller.AddWidget(kb2.QWidget)
-
-	win.OnResizeEvent(func(_ func(_ *qt6.QResizeEvent), evt *qt6.QResizeEvent) {
-		scaleLabel(evt.Size())
-	})
-
-	scaleLabel(win.Size())
-
-	win.OnCloseEvent(func(_ func(_ *qt6.QCloseEvent), evt *qt6.QCloseEvent) {
-		os.Exit(0)
-	})
-
-	win.OnShowEvent(func(_ func(event *qt6.QShowEvent), evt *qt6.QShowEvent) {
-		win.SetMaximumSize2(65535, 8192)
-		win.SetMinimumSize2(16, 16)
-
-		scaleLabel(win.Size())
-	})
-
-	win.OnKeyPressEvent(func(_ func(_ *qt6.QKeyEvent), evt *qt6.QKeyEvent) {
-		geo := win.Geometry()
-		step := 8
-		mods := evt.Modifiers()
-		if mods&qt6.ShiftModifier > 0 {
-			step = 32
-		} else if mods&qt6.ControlModifier > 0 {
-			step = 1
-		}
-
-		switch qt6.Key(evt.Key()) {
-		case qt6.Key_H, qt6.Key_Left:
-			win.SetGeometry(geo.X(), geo.Y(), max(16, geo.Width()-step), geo.Height())
-		case qt6.Key_J, qt6.Key_Down:
-			win.SetGeometry(geo.X(), geo.Y(), geo.Width(), min(8192, geo.Height()+step))
-		case qt6.Key_K, qt6.Key_Up:
-			win.SetGeometry(geo.X(), geo.Y(), geo.Width(), max(16, geo.Height()-step))
-		case qt6.Key_L, qt6.Key_Right:
-			win.SetGeometry(geo.X(), geo.Y(), min(8192, geo.Width()+step), geo.Height())
-		}
-	})
-
-	win.Show()
+	<-done
 }
 
 func grabKeyboards() []*evdev.InputDevice {
@@ -435,6 +389,7 @@ func listen(done chan bool, dev *evdev.InputDevice) {
 
 	path := dev.Path()
 	skip := map[evdev.EvType]*ModSet[bool]{}
+	scan := 0
 	name, err := dev.Name()
 	if err != nil {
 		panic(err)
@@ -447,310 +402,88 @@ func listen(done chan bool, dev *evdev.InputDevice) {
 			done <- true
 			return
 		}
-		fmt.Println(evt)
 
 		if skip[evt.Type] == nil {
 			skip[evt.Type] = &ModSet[bool]{}
 		}
 
-		go goHandle(dev, evt, skip[evt.Type])
+		var evtScan int
+		evtScan, scan = nextScan(scan, evt)
+		go goHandle(dev, name, evt, skip[evt.Type], evtScan)
 	}
 }
 
-func goHandle(dev *evdev.InputDevice, evt *evdev.InputEvent, skip *ModSet[bool]) {
-	ignoreMap, ok := ignoreEvt[evt.Type]
-	if !classes[evt.Type] || (ok && ignoreMap[evt.Code]) {
-		return
-	}
-
-	key := makeKey(skip, dev, evt)
-	if key == nil {
-		return
-	}
-
-	historyMu.Lock()
-	defer historyMu.Unlock()
-	var last *Key
-	if len(history) > 0 {
-		last = history[len(history)-1]
-		for i := len(history) - 1; (i >= 0) && (last.Type != key.Type); i-- {
-			fmt.Printf("-> %d\n", i)
-			last = history[i]
-		}
-	} else {
-		last = &Key{}
+// nextScan returns the scancode that goes with the event, given the last one
+// read from the device, and what to keep for the next event. The scancode
+// comes in its own event just before the key's.
+func nextScan(last int, evt *evdev.InputEvent) (int, int) {
+	if evt.Type == evdev.EV_MSC && evt.Code == evdev.MSC_SCAN {
+		last = int(evt.Value)
 	}
-	if last.Equals(*key) {
-		last.Count = last.Count + 1
-		// Move event to front of list
-		i := slices.Index(history, last)
-		c := len(history) - 1
-		if i < c {
-			history = slices.Concat(history[:i], history[i+1:], []*Key{last})
-		}
-	} else {
-		history = append(history, key)
+	if evt.Type == evdev.EV_KEY {
+		return last, 0
 	}
-
-	keyTime = time.Now()
-	PrintHistory()
-}
-
-type Key struct {
-	Type  evdev.EvType
-	Char  string
-	Code  evdev.EvCode
-	Name  string
-	Found bool
-	Held  ModSet[bool]
-	Count int
-	Q     *QKey
-	QLock *sync.Mutex
+	return last, last
 }
 
-type QKey struct {
-	Widget *qt6.QWidget
-	Layout *qt6.QVBoxLayout
-
-	KeyName   *qt6.QLabel
-	KeyCode   *qt6.QLabel
-	RepCount  *qt6.QLabel
-	CtrlBulb  *qt6.QLabel
-	MetaBulb  *qt6.QLabel
-	AltBulb   *qt6.QLabel
-	ShiftBulb *qt6.QLabel
-
-	HeadWidget *qt6.QWidget
-	HeadLayout *qt6.QHBoxLayout
-
-	FootWidget *qt6.QWidget
-	FootLayout *qt6.QHBoxLayout
-}
-
-func (this Key) Equals(other Key) bool {
-	return this.Name == other.Name &&
-		this.Held.Shift == other.Held.Shift &&
-		this.Held.Ctrl == other.Held.Ctrl &&
-		this.Held.Alt == other.Held.Alt &&
-		this.Held.Meta == other.Held.Meta
-}
-
-func (key Key) String(withCount bool) string {
-	sub := key.Char
-	r, sz := utf8.DecodeRuneInString(sub + ".")
-	if !key.Found {
-		sub = fmt.Sprintf("\x1b[92;1m<%d: %s>\x1b[0m", key.Code, key.Name)
-	} else if utf8.RuneCountInString(key.Char) > 1 && r < 255 {
-		sub = fmt.Sprintf("\x1b[1m%s\x1b[0m", sub)
-	} else if r == leftCharRune {
-		sub = fmt.Sprintf("\x1b[93;1m%s\x1b[94;1m%s\x1b[0m", leftChar, sub[sz:])
-	} else if r > 255 {
-		r, sz = utf8.DecodeLastRuneInString(sub)
-		if r == rightCharRune {
-			sub = fmt.Sprintf("\x1b[94;1m%s\x1b[93;1m%s\x1b[0m", sub[:len(sub)-sz], rightChar)
-		} else {
-			sub = fmt.Sprintf("\x1b[94;1m%s\x1b[0m", sub)
-		}
-	} else {
-		sub = strings.ToLower(sub)
+func goHandle(dev *evdev.InputDevice, name string, evt *evdev.InputEvent, skip *ModSet[bool], scan int) {
+	if capturePaused.Load() {
+		return
 	}
+	trackKey(evt)
 
-	if key.Held.Shift {
-		shift, exist := shifts[sub]
-		if exist {
-			sub = shift
-		} else {
-			sub = modLove.Shift + sub
-		}
-	}
-	if key.Held.Alt {
-		sub = modLove.Alt + sub
-	}
-	if key.Held.Ctrl {
-		sub = modLove.Ctrl + sub
-	}
-	if key.Held.Meta {
-		sub = modLove.Meta + sub
-	}
-	if withCount && key.Count > 1 {
-		sub = fmt.Sprintf("%s\x1b[95;3m×%d\x1b[0m", sub, key.Count)
+	filterMu.RLock()
+	ignored := !classes[evt.Type] || ignoreEvt[evt.Type][evt.Code]
+	filterMu.RUnlock()
+	if ignored {
+		return
 	}
+	recordHold(name, evt)
 
-	return sub
-}
-
-type Corner int
-
-const (
-	NoCorner Corner = iota
-	TopLeft
-	TopRight
-	BotLeft
-	BotRight
-)
-
-func styleKeyPart(corner Corner) string {
-	cornerSz := 4
-	switch corner {
-	case TopLeft:
-		return fmt.Sprintf("background-color: %s; border-top-left-radius: %dpx;", sakuraBg, cornerSz)
-	case TopRight:
-		return fmt.Sprintf("background-color: %s; border-top-right-radius: %dpx;", sakuraBg, cornerSz)
-	case BotLeft:
-		return fmt.Sprintf("background-color: %s; border-bottom-left-radius: %dpx;", sakuraBg, cornerSz)
-	case BotRight:
-		return fmt.Sprintf("background-color: %s; border-bottom-right-radius: %dpx;", sakuraBg, cornerSz)
-	default:
-		return fmt.Sprintf("background-color: %s;", sakuraBg)
+	key := makeKey(skip, dev, evt)
+	if key == nil {
+		return
 	}
-}
-
-func (key *Key) NewQ() bool {
-	if key.Q != nil {
-		return false
+	key.Device = name
+	if evt.Type == evdev.EV_KEY {
+		key.Scancode = scan
 	}
-
-	key.Q = &QKey{}
-	gap := 1
-
-	/*
-		| key code    |    repeat count |
-		|-------------------------------|
-		|                               |
-		|      key name                 |
-		|                               |
-		|-------------------------------|
-		| shift  | meta  | ctrl  | alt  |
-	*/
-	key.Q.Widget = qt6.NewQWidget(nil)
-	key.Q.Layout = qt6.NewQVBoxLayout(key.Q.Widget)
-	key.Q.Layout.SetContentsMargins(4, 4, 4, 4)
-
-	key.Q.KeyName = qt6.NewQLabel3(" ")
-	key.Q.KeyCode = qt6.NewQLabel3(" ")
-	key.Q.RepCount = qt6.NewQLabel3(" ")
-	key.Q.CtrlBulb = qt6.NewQLabel3(" ")
-	key.Q.AltBulb = qt6.NewQLabel3(" ")
-	key.Q.MetaBulb = qt6.NewQLabel3(" ")
-	key.Q.ShiftBulb = qt6.NewQLabel3(" ")
-
-	key.Q.KeyName.SetStyleSheet(styleKeyPart(NoCorner))
-	key.Q.KeyCode.SetStyleSheet(styleKeyPart(TopLeft))
-	key.Q.RepCount.SetStyleSheet(styleKeyPart(TopRight))
-	key.Q.CtrlBulb.SetStyleSheet(styleKeyPart(BotLeft))
-	key.Q.AltBulb.SetStyleSheet(styleKeyPart(NoCorner))
-	key.Q.MetaBulb.SetStyleSheet(styleKeyPart(NoCorner))
-	key.Q.ShiftBulb.SetStyleSheet(styleKeyPart(BotRight))
-
-	key.Q.HeadWidget = qt6.NewQWidget(nil)
-	key.Q.HeadLayout = qt6.NewQHBoxLayout(key.Q.HeadWidget)
-	key.Q.HeadLayout.SetContentsMargins(0, 0, 0, 0)
-	key.Q.HeadLayout.SetSpacing(gap)
-	key.Q.HeadLayout.AddWidget(key.Q.RepCount.QWidget)
-	key.Q.HeadLayout.AddWidget(key.Q.KeyCode.QWidget)
-	key.Q.RepCount.SetAlignment(qt6.AlignRight)
-
-	key.Q.FootWidget = qt6.NewQWidget(nil)
-	key.Q.FootLayout = qt6.NewQHBoxLayout(key.Q.FootWidget)
-	key.Q.FootLayout.SetContentsMargins(0, 0, 0, 0)
-	key.Q.FootLayout.SetSpacing(gap)
-	key.Q.ShiftBulb.SetAlignment(qt6.AlignCenter)
-	key.Q.MetaBulb.SetAlignment(qt6.AlignCenter)
-	key.Q.CtrlBulb.SetAlignment(qt6.AlignCenter)
-	key.Q.AltBulb.SetAlignment(qt6.AlignCenter)
-	key.Q.FootLayout.AddWidget(key.Q.ShiftBulb.QWidget)
-	key.Q.FootLayout.AddWidget(key.Q.AltBulb.QWidget)
-	key.Q.FootLayout.AddWidget(key.Q.MetaBulb.QWidget)
-	key.Q.FootLayout.AddWidget(key.Q.CtrlBulb.QWidget)
-
-	key.Q.Layout.SetSpacing(gap)
-	key.Q.Layout.AddWidget(key.Q.HeadWidget)
-	key.Q.Layout.AddWidget2(key.Q.KeyName.QWidget, 1)
-	key.Q.Layout.AddWidget(key.Q.FootWidget)
-	key.Q.KeyName.SetAlignment(qt6.AlignCenter)
-
-	return true
+	handleKey(key)
 }
 
-func (key *Key) Widget() *qt6.QWidget {
-	if key.QLock == nil {
-		key.QLock = &sync.Mutex{}
+// handleKey adds a new key to the history and asks for it to be drawn
+func handleKey(key *Key) {
+	if nvim != nil {
+		key.Mode, key.Action = nvim.Resolve(key)
 	}
-	key.QLock.Lock()
-	defer key.QLock.Unlock()
 
-	if !key.NewQ() {
-		if key.Count < 2 {
-			key.Q.RepCount.SetText(" ")
-		} else {
-			key.Q.RepCount.SetText(fmt.Sprintf("x%d", key.Count))
-		}
-		return nil
+	historyMu.Lock()
+	var chip *Key
+	if textMode {
+		chip = typeText(key)
 	}
-
-	sub := key.Char
-	r, sz := utf8.DecodeRuneInString(sub + ".")
-	skipShift := false
-	if !key.Found {
-		if strings.HasPrefix(key.Name, "KEY_") {
-			key.Q.KeyCode.SetText(fmt.Sprintf("key <b>%d</b>", key.Code))
-			key.Q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name[len("KEY_"):]))
-		} else if strings.HasPrefix(key.Name, "BTN_") {
-			key.Q.KeyCode.SetText(fmt.Sprintf("btn <b>%d</b>", key.Code))
-			key.Q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name[len("BTN_"):]))
-		} else {
-			key.Q.KeyCode.SetText(fmt.Sprintf("<b>%d</b>", key.Code))
-			key.Q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name))
-		}
-	} else if utf8.RuneCountInString(key.Char) > 1 && r < 255 {
-		key.Q.KeyName.SetText(fmt.Sprintf("<b>%s</b>", sub))
-	} else if r == leftCharRune {
-		key.Q.KeyName.SetText(
-			fmt.Sprintf("<font color='%s'>%s</font>", sakuraGold, leftChar) +
-				fmt.Sprintf("<font color='%s'><b>%s</b></font>", sakuraIris, sub[sz:]),
-		)
-	} else if r > 255 {
-		r, sz = utf8.DecodeLastRuneInString(sub)
-		if r == rightCharRune {
-			key.Q.KeyName.SetText(
-				fmt.Sprintf("<font color='%s'><b>%s</b></font>", sakuraIris, sub[:len(sub)-sz]) +
-					fmt.Sprintf("<font color='%s'>%s</font>", sakuraGold, rightChar),
-			)
-		} else {
-			key.Q.KeyName.SetText(
-				fmt.Sprintf("<font color='%s'><b>%s</b></font>", sakuraIris, sub),
-			)
-		}
-	} else if shift, exist := shifts[strings.ToLower(sub)]; key.Held.Shift && exist {
-		skipShift = true
-		key.Q.KeyName.SetText(shift)
-	} else {
-		key.Q.KeyName.SetText(strings.ToLower(sub))
+	if chip == nil {
+		chip = mergeKey(history, key)
 	}
+	snap := *chip
+	historyMu.Unlock()
 
-	if key.Held.Shift && !skipShift {
-		key.Q.ShiftBulb.SetText(fmt.Sprintf("<font color='%s'><b>%s</font>", sakuraLove, modChar.Shift))
-	}
-	if key.Held.Meta {
-		key.Q.MetaBulb.SetText(fmt.Sprintf("<font color='%s'><b>%s</font>", sakuraLove, modChar.Meta))
-	}
-	if key.Held.Ctrl {
-		key.Q.CtrlBulb.SetText(fmt.Sprintf("<font color='%s'><b>%s</font>", sakuraLove, modChar.Ctrl))
+	if obs, ok := renderer.(ChipObserver); ok {
+		obs.Chip(snap)
 	}
-	if key.Held.Alt {
-		key.Q.AltBulb.SetText(fmt.Sprintf("<font color='%s'><b>%s</font>", sakuraLove, modChar.Alt))
-	}
-
-	return key.Q.Widget
+	Redraw()
 }
 
 func makeKey(skip *ModSet[bool], dev *evdev.InputDevice, evt *evdev.InputEvent) *Key {
 	key := Key{
-		Type:  evt.Type,
-		Code:  evt.Code,
-		Name:  evt.CodeName(),
-		Held:  modState(dev),
-		Count: 1,
+		ID:     nextKeyID(),
+		Type:   evt.Type,
+		Code:   evt.Code,
+		Name:   evt.CodeName(),
+		Held:   modState(dev),
+		Count:  1,
+		Repeat: evt.Value == 2,
+		Time:   time.Now(),
 	}
 
 	if charMap, ok := tokens[evt.Type]; ok {
@@ -804,103 +537,6 @@ func modState(dev *evdev.InputDevice) ModSet[bool] {
 	}
 }
 
-func PrintQtHistory() {
-	labelMu.Lock()
-	defer labelMu.Unlock()
-
-	var i int
-	sz := kb2.Size().Height() - 8
-	if len(history) == 0 {
-		recursiveClear(kblist.QLayout)
-		kblist.AddStretch()
-	}
-
-	metrics := qt6.NewQFontMetrics(font)
-	altFont := qt6.NewQFont5(font)
-	smallFont := qt6.NewQFont5(font)
-	smallerFont := qt6.NewQFont5(font)
-	if sz < 32 {
-		font.SetPixelSize(sz / 4)
-		smallFont.SetPixelSize(sz / 4)
-	} else if sz < 64 {
-		font.SetPixelSize(sz / 3)
-		smallFont.SetPixelSize(sz / 6)
-	} else {
-		font.SetPixelSize(sz / 2)
-		smallFont.SetPixelSize(sz / 8)
-	}
-	smallerFont.SetPixelSize(smallFont.PixelSize() * 3 / 4)
-
-	for i = len(history) - 1; i >= 0; i-- {
-		key := history[i]
-		if key.Char == "\x00" {
-			continue
-		}
-
-		if widget := key.Widget(); widget != nil {
-			kblist.AddWidget(widget)
-		}
-
-		if key.Found {
-			key.Q.KeyName.SetFont(font)
-			key.Q.Widget.SetFixedSize2(sz, sz)
-		} else {
-			bounds := metrics.BoundingRectWithText(key.Q.KeyName.Text())
-			ratio := float64(bounds.Height()) / float64(bounds.Width())
-			height := ratio * float64(sz) * 4
-			altFont.SetPixelSize(int(height))
-			key.Q.KeyName.SetFont(altFont)
-			key.Q.Widget.SetFixedSize2(sz*2, sz)
-		}
-		key.Q.AltBulb.SetFont(smallFont)
-		key.Q.CtrlBulb.SetFont(smallFont)
-		key.Q.MetaBulb.SetFont(smallFont)
-		key.Q.RepCount.SetFont(smallFont)
-		key.Q.KeyCode.SetFont(smallFont)
-		key.Q.ShiftBulb.SetFont(smallerFont)
-		key.Q.ShiftBulb.SetFixedHeight(smallFont.PixelSize() * 4 / 3)
-	}
-}
-
-func PrintHistory() {
-	if font != nil {
-		mainthread.Start(PrintQtHistory)
-		return
-	}
-
-	w, _, err := term.GetSize(0)
-	if err != nil {
-		return
-	}
-
-	var i int
-	st := ""
-	l := 0
-	for i = len(history) - 1; i >= 0; i-- {
-		key := history[i]
-		if key.Char == "\x00" {
-			continue
-		}
-		new_st := key.String(true) + " " + st
-		new_l := utf8.RuneCountInString(ansi.ReplaceAllString(new_st, ""))
-		if new_l >= w {
-			break
-		}
-		st = new_st
-		l = new_l
-	}
-
-	if len(history) > 10*w {
-		history = history[10*w:]
-	}
-
-	st = strings.Repeat(" ", max(0, w-l)) + st
-
-	fmt.Printf("\x1b[H\x1b[2J%s\r", st)
-}
-
-var ansi = regexp.MustCompile("\x1b\\[\\d+(;\\d+)?m")
-
 var shifts = map[string]string{
 	"a": "A", "b": "B", "c": "C", "d": "D", "e": "E", "f": "F",
 	"g": "G", "h": "H", "i": "I", "j": "J", "k": "K", "l": "L",
@@ -926,13 +562,6 @@ var modChar = ModSet[string]{
 	Meta:  "",
 }
 
-var modLove = ModSet[string]{
-	Shift: "\x1b[91;1m" + modChar.Shift + "\x1b[0m",
-	Ctrl:  "\x1b[91;1m" + modChar.Ctrl + "\x1b[0m",
-	Alt:   "\x1b[91;1m" + modChar.Alt + "\x1b[0m",
-	Meta:  "\x1b[91;1m" + modChar.Meta + "\x1b[0m",
-}
-
 var (
 	rightChar        = ""
 	leftChar         = ""
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+func TestNextScan(t *testing.T) {
+	scanEvt := func(val int32) *evdev.InputEvent {
+		return &evdev.InputEvent{Type: evdev.EV_MSC, Code: evdev.MSC_SCAN, Value: val}
+	}
+	keyEvt := func(val int32) *evdev.InputEvent {
+		return &evdev.InputEvent{Type: evdev.EV_KEY, Code: evdev.KEY_A, Value: val}
+	}
+	syn := &evdev.InputEvent{Type: evdev.EV_SYN}
+
+	for _, tt := range []struct {
+		name string
+		evts []*evdev.InputEvent
+		want []int
+	}{
+		{"press and release", []*evdev.InputEvent{scanEvt(0x1e), keyEvt(1), syn, scanEvt(0x1e), keyEvt(0), syn}, []int{0x1e, 0x1e}},
+		// Autorepeat comes without a scancode of its own
+		{"repeat", []*evdev.InputEvent{scanEvt(0x1e), keyEvt(1), syn, keyEvt(2), syn}, []int{0x1e, 0}},
+		{"no scancodes", []*evdev.InputEvent{keyEvt(1), syn, keyEvt(0), syn}, []int{0, 0}},
+		{"only the newest counts", []*evdev.InputEvent{scanEvt(0x10), scanEvt(0x1e), keyEvt(1)}, []int{0x1e}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scans := []int{}
+			last := 0
+			for _, evt := range tt.evts {
+				var scan int
+				scan, last = nextScan(last, evt)
+				if evt.Type == evdev.EV_KEY {
+					scans = append(scans, scan)
+				}
+			}
+			if !slices.Equal(scans, tt.want) {
+				t.Errorf("scancodes %#x, want %#x", scans, tt.want)
+			}
+		})
+	}
+}
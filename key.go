@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// Key is one chip in the history. Renderers only ever see copies of it, so
+// it must stay plain data.
+type Key struct {
+	ID     uint64
+	Type   evdev.EvType
+	Char   string
+	Code   evdev.EvCode
+	Name   string
+	Found  bool
+	Device string
+	Repeat bool
+	Held   ModSet[bool]
+	Count  int
+	Mode   string
+	Action string
+	Text   bool
+	Open   bool
+	Time   time.Time
+	// From the MSC_SCAN event before the press, 0 if there wasn't one
+	Scancode int
+	// How long the last press was held, 0 until it's released
+	Hold time.Duration
+}
+
+var lastKeyID atomic.Uint64
+
+func nextKeyID() uint64 {
+	return lastKeyID.Add(1)
+}
+
+func (this Key) Equals(other Key) bool {
+	return this.Name == other.Name &&
+		this.Mode == other.Mode &&
+		this.Action == other.Action &&
+		this.Held.Shift == other.Held.Shift &&
+		this.Held.Ctrl == other.Held.Ctrl &&
+		this.Held.Alt == other.Held.Alt &&
+		this.Held.Meta == other.Held.Meta
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// KLEKey is one key from a keyboard-layout-editor.com layout, in key units
+type KLEKey struct {
+	X, Y, W, H float64
+	// Rotation in degrees around (RX, RY)
+	R, RX, RY float64
+	Legend    string
+	Code      evdev.EvCode
+	Mapped    bool
+}
+
+type KeyboardLayout struct {
+	Keys []KLEKey
+	// Size of the bounding box, in key units
+	W, H float64
+}
+
+var keyboard *KeyboardLayout
+
+// ANSI and ISO 60% boards with a function row, and a 5x12 ortholinear
+// board. A legend line naming a code outright, as KEY_ANYTHING or as a
+// number of two digits or more, picks the key for legends that would
+// otherwise be ambiguous.
+var keyboardPresets = map[string]string{
+	"ansi": `[
+	["Esc", {"x": 1}, "F1", "F2", "F3", "F4", {"x": 0.5}, "F5", "F6", "F7", "F8", {"x": 0.5}, "F9", "F10", "F11", "F12"],
+	[{"y": 0.5}, "~\n` + "`" + `", "!\n1", "@\n2", "#\n3", "$\n4", "%\n5", "^\n6", "&\n7", "*\n8", "(\n9", ")\n0", "_\n-", "+\n=", {"w": 2}, "Backspace"],
+	[{"w": 1.5}, "Tab", "Q", "W", "E", "R", "T", "Y", "U", "I", "O", "P", "{\n[", "}\n]", {"w": 1.5}, "|\n\\"],
+	[{"w": 1.75}, "Caps Lock", "A", "S", "D", "F", "G", "H", "J", "K", "L", ":\n;", "\"\n'", {"w": 2.25}, "Enter"],
+	[{"w": 2.25}, "Shift", "Z", "X", "C", "V", "B", "N", "M", "<\n,", ">\n.", "?\n/", {"w": 2.75}, "Shift"],
+	[{"w": 1.25}, "Ctrl", {"w": 1.25}, "Win", {"w": 1.25}, "Alt", {"w": 6.25}, "", {"w": 1.25}, "Alt", {"w": 1.25}, "Win", {"w": 1.25}, "Menu", {"w": 1.25}, "Ctrl"]
+]`,
+	"iso": `[
+	["Esc", {"x": 1}, "F1", "F2", "F3", "F4", {"x": 0.5}, "F5", "F6", "F7", "F8", {"x": 0.5}, "F9", "F10", "F11", "F12"],
+	[{"y": 0.5}, "¬\n` + "`" + `", "!\n1", "\"\n2", "£\n3", "$\n4", "%\n5", "^\n6", "&\n7", "*\n8", "(\n9", ")\n0", "_\n-", "+\n=", {"w": 2}, "Backspace"],
+	[{"w": 1.5}, "Tab", "Q", "W", "E", "R", "T", "Y", "U", "I", "O", "P", "{\n[", "}\n]", {"x": 0.25, "w": 1.25, "h": 2}, "Enter"],
+	[{"w": 1.75}, "Caps Lock", "A", "S", "D", "F", "G", "H", "J", "K", "L", ":\n;", "@\n'", "~\n#\nKEY_BACKSLASH"],
+	[{"w": 1.25}, "Shift", "|\n\\\nKEY_102ND", "Z", "X", "C", "V", "B", "N", "M", "<\n,", ">\n.", "?\n/", {"w": 2.75}, "Shift"],
+	[{"w": 1.25}, "Ctrl", {"w": 1.25}, "Win", {"w": 1.25}, "Alt", {"w": 6.25}, "", {"w": 1.25}, "AltGr", {"w": 1.25}, "Win", {"w": 1.25}, "Menu", {"w": 1.25}, "Ctrl"]
+]`,
+	"ortho": `[
+	["` + "`" + `", "1", "2", "3", "4", "5", "6", "7", "8", "9", "0", "Backspace"],
+	["Tab", "Q", "W", "E", "R", "T", "Y", "U", "I", "O", "P", "Del"],
+	["Esc", "A", "S", "D", "F", "G", "H", "J", "K", "L", ";", "'"],
+	["Shift", "Z", "X", "C", "V", "B", "N", "M", ",", ".", "/", "Enter"],
+	["Ctrl", "Win", "Alt", "Menu", "Lower", {"w": 2}, "KEY_SPACE", "Raise", "←", "↓", "↑", "→"]
+]`,
+}
+
+func applyKeyboard(val string) error {
+	name := strings.ToLower(val)
+	if name == "builtin" {
+		// The only layout there was before the presets
+		name = "ansi"
+	}
+	data := []byte(keyboardPresets[name])
+	if len(data) == 0 {
+		var err error
+		if data, err = os.ReadFile(val); err != nil {
+			return err
+		}
+	}
+
+	layout, err := parseKLE(data)
+	if err != nil {
+		return fmt.Errorf("layout `%s': %w", val, err)
+	}
+	keyboard = layout
+	return nil
+}
+
+// parseKLE reads the raw data downloaded from keyboard-layout-editor.com:
+// an optional metadata object followed by rows of legends, each optionally
+// preceded by an object changing the next key's position and size
+func parseKLE(data []byte) (*KeyboardLayout, error) {
+	rows := []json.RawMessage{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+
+	layout := &KeyboardLayout{}
+	cur := KLEKey{W: 1, H: 1}
+	clusterX, clusterY := 0.0, 0.0
+	for _, raw := range rows {
+		row := []json.RawMessage{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			// Keyboard metadata
+			continue
+		}
+
+		for _, item := range row {
+			legend := ""
+			if err := json.Unmarshal(item, &legend); err == nil {
+				key := cur
+				key.Legend = legend
+				layout.Keys = append(layout.Keys, key)
+				cur.X += cur.W
+				cur.W, cur.H = 1, 1
+				continue
+			}
+
+			props := map[string]any{}
+			if err := json.Unmarshal(item, &props); err != nil {
+				return nil, fmt.Errorf("key must be a legend or properties, not %s", item)
+			}
+			num := func(name string) (float64, bool) {
+				val, ok := props[name].(float64)
+				return val, ok
+			}
+			if r, ok := num("r"); ok {
+				cur.R = r
+			}
+			if rx, ok := num("rx"); ok {
+				cur.RX, clusterX = rx, rx
+				cur.X, cur.Y = clusterX, clusterY
+			}
+			if ry, ok := num("ry"); ok {
+				cur.RY, clusterY = ry, ry
+				cur.X, cur.Y = clusterX, clusterY
+			}
+			if x, ok := num("x"); ok {
+				cur.X += x
+			}
+			if y, ok := num("y"); ok {
+				cur.Y += y
+			}
+			if w, ok := num("w"); ok {
+				cur.W = w
+			}
+			if h, ok := num("h"); ok {
+				cur.H = h
+			}
+		}
+		cur.Y++
+		cur.X = cur.RX
+	}
+
+	mapLegends(layout.Keys)
+	if len(layout.Keys) == 0 {
+		return layout, nil
+	}
+
+	// Keys can be moved up or left of the origin, so the layout is shifted
+	// to start at 0,0
+	minX, minY := layout.Keys[0].X, layout.Keys[0].Y
+	for _, key := range layout.Keys {
+		minX, minY = min(minX, key.X), min(minY, key.Y)
+	}
+	for i := range layout.Keys {
+		key := &layout.Keys[i]
+		key.X, key.RX = key.X-minX, key.RX-minX
+		key.Y, key.RY = key.Y-minY, key.RY-minY
+		layout.W = max(layout.W, key.X+key.W)
+		layout.H = max(layout.H, key.Y+key.H)
+	}
+	return layout, nil
+}
+
+// legendNames maps legends that don't match an evdev name as-is. Shift,
+// Ctrl, Alt and Win map to the left key the first time and the right key
+// after that.
+var legendNames = map[string][]string{
+	"esc": {"ESC"}, "escape": {"ESC"}, "caps lock": {"CAPSLOCK"}, "caps": {"CAPSLOCK"},
+	"return": {"ENTER"}, "bksp": {"BACKSPACE"}, "del": {"DELETE"}, "ins": {"INSERT"},
+	"pgup": {"PAGEUP"}, "pgdn": {"PAGEDOWN"}, "page up": {"PAGEUP"}, "page down": {"PAGEDOWN"},
+	"menu": {"COMPOSE"}, "prtsc": {"SYSRQ"}, "print screen": {"SYSRQ"}, "scroll lock": {"SCROLLLOCK"},
+	"num lock": {"NUMLOCK"}, "": {"SPACE"}, "space": {"SPACE"},
+	"↑": {"UP"}, "↓": {"DOWN"}, "←": {"LEFT"}, "→": {"RIGHT"},
+	"`": {"GRAVE"}, "-": {"MINUS"}, "=": {"EQUAL"}, "[": {"LEFTBRACE"}, "]": {"RIGHTBRACE"},
+	"\\": {"BACKSLASH"}, ";": {"SEMICOLON"}, "'": {"APOSTROPHE"}, ",": {"COMMA"}, ".": {"DOT"}, "/": {"SLASH"},
+	"shift": {"LEFTSHIFT", "RIGHTSHIFT"}, "ctrl": {"LEFTCTRL", "RIGHTCTRL"}, "control": {"LEFTCTRL", "RIGHTCTRL"},
+	"alt": {"LEFTALT", "RIGHTALT"}, "altgr": {"RIGHTALT"}, "win": {"LEFTMETA", "RIGHTMETA"},
+	"super": {"LEFTMETA", "RIGHTMETA"}, "meta": {"LEFTMETA", "RIGHTMETA"}, "cmd": {"LEFTMETA", "RIGHTMETA"},
+}
+
+// mapLegends finds the evdev code for each key from its legends. A legend
+// line can also name the code outright, eg KEY_F13, in which case it's
+// taken out of the legend.
+func mapLegends(keys []KLEKey) {
+	seen := map[string]int{}
+	for i := range keys {
+		key := &keys[i]
+		lines := strings.Split(key.Legend, "\n")
+		shown := []string{}
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if code, ok := evdev.KEYFromString[line]; ok && strings.HasPrefix(line, "KEY_") {
+				key.Code, key.Mapped = code, true
+			} else if code, err := strconv.Atoi(line); err == nil && len(line) > 1 && code >= 0 && code <= evdev.KEY_MAX {
+				// Single digits are the number keys
+				key.Code, key.Mapped = evdev.EvCode(code), true
+			} else {
+				shown = append(shown, line)
+			}
+		}
+		if key.Mapped {
+			key.Legend = strings.Join(shown, "\n")
+			continue
+		}
+		if key.Legend == "" && key.W < 3 {
+			continue
+		}
+
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			name := "KEY_" + strings.ToUpper(strings.ReplaceAll(line, " ", ""))
+			if names, ok := legendNames[strings.ToLower(line)]; ok {
+				name = "KEY_" + names[min(seen[strings.ToLower(line)], len(names)-1)]
+				seen[strings.ToLower(line)]++
+			}
+			if code, ok := evdev.KEYFromString[name]; ok {
+				key.Code, key.Mapped = code, true
+				break
+			}
+		}
+	}
+}
+
+// Keys held down, and when the rest were last released
+var (
+	keysDown   = map[evdev.EvCode]bool{}
+	keysUp     = map[evdev.EvCode]time.Time{}
+	keyStateMu sync.Mutex
+)
+
+// trackKey records a raw press or release for the keyboard diagram
+func trackKey(evt *evdev.InputEvent) {
+	if keyboard == nil || evt.Type != evdev.EV_KEY || evt.Value == 2 {
+		return
+	}
+
+	keyStateMu.Lock()
+	if evt.Value == 0 {
+		delete(keysDown, evt.Code)
+		keysUp[evt.Code] = time.Now()
+	} else {
+		keysDown[evt.Code] = true
+		delete(keysUp, evt.Code)
+	}
+	keyStateMu.Unlock()
+	Redraw()
+}
+
+// KeyLight is how lit up the key is: 1 while held, fading to 0 after it's
+// released
+func KeyLight(code evdev.EvCode, now time.Time) float64 {
+	keyStateMu.Lock()
+	defer keyStateMu.Unlock()
+
+	if keysDown[code] {
+		return 1
+	}
+	up, ok := keysUp[code]
+	if !ok || defaultFade <= 0 {
+		return 0
+	}
+	return max(0, 1-float64(now.Sub(up))/float64(defaultFade))
+}
+
+// keyboardFading reports whether the diagram needs another frame for keys
+// fading out, forgetting those that are done after their last frame
+func keyboardFading(now time.Time) bool {
+	keyStateMu.Lock()
+	defer keyStateMu.Unlock()
+
+	changed := false
+	for code, up := range keysUp {
+		if now.Sub(up) >= defaultFade {
+			delete(keysUp, code)
+		}
+		changed = true
+	}
+	return changed
+}
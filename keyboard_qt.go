@@ -0,0 +1,76 @@
+//go:build !noqt
+
+package main
+
+import (
+	"time"
+
+	"github.com/mappu/miqt/qt6"
+)
+
+var kbview *qt6.QWidget
+
+// newKeyboardView draws the keyboard layout, lighting up held keys and
+// fading them out once released
+func newKeyboardView() *qt6.QWidget {
+	view := qt6.NewQWidget(nil)
+	view.SetMinimumSize2(64, 24)
+	view.OnPaintEvent(func(_ func(_ *qt6.QPaintEvent), _ *qt6.QPaintEvent) {
+		paintKeyboard(view)
+	})
+	return view
+}
+
+func mixColor(from, to string, t float64) *qt6.QColor {
+	return qt6.NewQColor6(mixHex(from, to, t))
+}
+
+func paintKeyboard(view *qt6.QWidget) {
+	if keyboard == nil || keyboard.W <= 0 || keyboard.H <= 0 {
+		return
+	}
+
+	p := qt6.NewQPainter2(view.QPaintDevice)
+	defer p.End()
+	p.SetRenderHint(qt6.QPainter__Antialiasing)
+
+	unit := min(float64(view.Width())/keyboard.W, float64(view.Height())/keyboard.H)
+	gap := max(1, unit/16)
+	legendFont := qt6.NewQFont5(font)
+	legendFont.SetPixelSize(max(1, int(unit/4)))
+	p.SetFont(legendFont)
+	p.Translate2((float64(view.Width())-unit*keyboard.W)/2, (float64(view.Height())-unit*keyboard.H)/2)
+
+	now := time.Now()
+	for _, key := range keyboard.Keys {
+		p.Save()
+		if key.R != 0 {
+			p.Translate2(key.RX*unit, key.RY*unit)
+			p.Rotate(key.R)
+			p.Translate2(-key.RX*unit, -key.RY*unit)
+		}
+
+		light := 0.0
+		if key.Mapped {
+			light = KeyLight(key.Code, now)
+		}
+		// Modifiers light up in the same color as their bulbs on the chips
+		lit := sakuraRose
+		if modifierKeys[key.Code] {
+			lit = sakuraLove
+		}
+
+		rect := qt6.NewQRectF4(key.X*unit+gap, key.Y*unit+gap, key.W*unit-2*gap, key.H*unit-2*gap)
+		p.SetPenWithStyle(qt6.NoPen)
+		p.SetBrush(qt6.NewQBrush3(mixColor(sakuraBg, lit, light)))
+		p.DrawRoundedRect(rect, float64(themeRadius), float64(themeRadius))
+
+		if key.Mapped {
+			p.SetPen(mixColor(textColor(sakuraBg), contrastColor(lit), light))
+		} else {
+			p.SetPen(mixColor(textColor(sakuraBg), sakuraBg, 0.5))
+		}
+		p.DrawText5(rect, int(qt6.AlignCenter), key.Legend)
+		p.Restore()
+	}
+}
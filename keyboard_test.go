@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+func TestParseKLEBounds(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		w, h float64
+		// Position of the first key after shifting
+		x, y float64
+	}{
+		{"plain", `[["A", "B"], ["C"]]`, 2, 2, 0, 0},
+		{"offset right", `[[{"x": 1}, "A"]]`, 1, 1, 0, 0},
+		{"left of the origin", `[[{"x": -1.5}, "A", "B"]]`, 2, 1, 0, 0},
+		{"above the origin", `[[{"y": -2}, "A"], ["B"]]`, 1, 2, 0, 0},
+		{"rest pulled back", `[["A"], [{"x": -2, "y": -3}, "B"]]`, 3, 3, 2, 2},
+		{"rotated cluster", `[["A"], [{"r": 15, "rx": -1, "ry": -1}, "B"]]`, 2, 2, 1, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := parseKLE([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout.W != tt.w || layout.H != tt.h {
+				t.Errorf("size %gx%g, want %gx%g", layout.W, layout.H, tt.w, tt.h)
+			}
+			if key := layout.Keys[0]; key.X != tt.x || key.Y != tt.y {
+				t.Errorf("first key at %g,%g, want %g,%g", key.X, key.Y, tt.x, tt.y)
+			}
+			for _, key := range layout.Keys {
+				if key.X < 0 || key.Y < 0 || key.X+key.W > layout.W || key.Y+key.H > layout.H {
+					t.Errorf("key %q at %g,%g is outside %gx%g", key.Legend, key.X, key.Y, layout.W, layout.H)
+				}
+			}
+		})
+	}
+}
+
+func TestParseKLERotation(t *testing.T) {
+	// The rotation origin moves with the keys, so rotated keys stay put
+	// relative to the rest
+	layout, err := parseKLE([]byte(`[[{"x": -1}, "A"], [{"r": 30, "rx": 2, "ry": 1}, "B"]]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := layout.Keys[1]
+	if b.RX != 3 || b.RY != 1 || b.X != 3 || b.Y != 1 {
+		t.Errorf("rotated key at %g,%g around %g,%g, want 3,1 around 3,1", b.X, b.Y, b.RX, b.RY)
+	}
+}
+
+func TestKeyboardPresets(t *testing.T) {
+	for name, data := range keyboardPresets {
+		t.Run(name, func(t *testing.T) {
+			layout, err := parseKLE([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Layer keys like Lower and Raise never reach evdev, so only
+			// the mapped keys are checked
+			seen := map[string]bool{}
+			for _, key := range layout.Keys {
+				if !key.Mapped {
+					continue
+				}
+				code := evdev.CodeName(evdev.EV_KEY, key.Code)
+				if seen[code] {
+					t.Errorf("%s is on the board twice", code)
+				}
+				seen[code] = true
+			}
+			if !seen["KEY_SPACE"] {
+				t.Error("no space bar")
+			}
+		})
+	}
+}
+
+func TestMapLegends(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		legend string
+		code   evdev.EvCode
+		mapped bool
+		shown  string
+	}{
+		{"name", "Esc", evdev.KEY_ESC, true, "Esc"},
+		{"number key", "!\n1", evdev.KEY_1, true, "!\n1"},
+		{"numeric code", "183", evdev.KEY_F13, true, ""},
+		{"numeric code with a legend", "F13\n183", evdev.KEY_F13, true, "F13"},
+		{"padded code", "01", evdev.KEY_ESC, true, ""},
+		{"code name", "Fn\nKEY_FN", evdev.KEY_FN, true, "Fn"},
+		{"code past the end", "99999", 0, false, "99999"},
+		{"unknown", "Lower", 0, false, "Lower"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := []KLEKey{{W: 1, H: 1, Legend: tt.legend}}
+			mapLegends(keys)
+			if key := keys[0]; key.Code != tt.code || key.Mapped != tt.mapped || key.Legend != tt.shown {
+				t.Errorf("%s mapped %v, showing %q; want %s mapped %v, showing %q",
+					evdev.CodeName(evdev.EV_KEY, key.Code), key.Mapped, key.Legend,
+					evdev.CodeName(evdev.EV_KEY, tt.code), tt.mapped, tt.shown)
+			}
+		})
+	}
+}
+
+func TestApplyKeyboard(t *testing.T) {
+	old := keyboard
+	t.Cleanup(func() { keyboard = old })
+
+	for _, name := range []string{"ansi", "builtin", "Builtin", "ISO", "ortho"} {
+		if err := applyKeyboard(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	if err := applyKeyboard("builtin"); err != nil {
+		t.Fatal(err)
+	}
+	builtin := keyboard
+	if err := applyKeyboard("ansi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(builtin.Keys) != len(keyboard.Keys) {
+		t.Errorf("builtin has %d keys, ansi has %d", len(builtin.Keys), len(keyboard.Keys))
+	}
+	if err := applyKeyboard(filepath.Join(t.TempDir(), "nope.json")); err == nil {
+		t.Error("loaded a layout that doesn't exist")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	rasterFont     *sfnt.Font
+	rasterFontOnce sync.Once
+	rasterFaces    = map[int]xfont.Face{}
+	rasterFacesMu  sync.Mutex
+)
+
+// loadRasterFont looks up the -font family with fontconfig so Nerd Font
+// glyphs come out right, falling back to Go's own font
+func loadRasterFont() *sfnt.Font {
+	rasterFontOnce.Do(func() {
+		family := "monospace"
+		if _flagFontFamily != nil && *_flagFontFamily != "" {
+			family = *_flagFontFamily
+		}
+
+		out, err := exec.Command("fc-match", "--format=%{file}", family).Output()
+		if err == nil {
+			if data, err := os.ReadFile(strings.TrimSpace(string(out))); err == nil {
+				if coll, err := opentype.ParseCollection(data); err == nil && coll.NumFonts() > 0 {
+					rasterFont, _ = coll.Font(0)
+				}
+			}
+		}
+		if rasterFont == nil {
+			rasterFont, _ = opentype.Parse(goregular.TTF)
+		}
+	})
+	return rasterFont
+}
+
+func rasterFace(px int) xfont.Face {
+	rasterFacesMu.Lock()
+	defer rasterFacesMu.Unlock()
+
+	if face, ok := rasterFaces[px]; ok {
+		return face
+	}
+	face, err := opentype.NewFace(loadRasterFont(), &opentype.FaceOptions{
+		Size:    float64(px),
+		DPI:     72,
+		Hinting: xfont.HintingFull,
+	})
+	if err != nil {
+		return nil
+	}
+	rasterFaces[px] = face
+	return face
+}
+
+func hexColor(hex string, opacity float64) color.NRGBA {
+	r, g, b := parseHex(hex)
+	return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(255 * opacity)}
+}
+
+// fillRounded fills the rectangle with its corners rounded off
+func fillRounded(img draw.Image, rect image.Rectangle, radius int, c color.Color) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			dx := max(rect.Min.X+radius-x, x-(rect.Max.X-radius-1), 0)
+			dy := max(rect.Min.Y+radius-y, y-(rect.Max.Y-radius-1), 0)
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+func measureSegments(face xfont.Face, segs []Segment) int {
+	return xfont.MeasureString(face, segmentsText(segs)).Ceil()
+}
+
+// drawSegments draws the segments with their baseline at y, in the text
+// color unless they bring their own
+func drawSegments(img draw.Image, face xfont.Face, segs []Segment, x, y int, fg string, opacity float64) {
+	d := xfont.Drawer{Dst: img, Face: face, Dot: fixed.P(x, y)}
+	for _, seg := range segs {
+		c := fg
+		if seg.Color != nil {
+			c = *seg.Color
+		}
+		alpha := opacity
+		if seg.Dim {
+			alpha /= 2
+		}
+		d.Src = image.NewUniform(hexColor(c, alpha))
+		d.DrawString(seg.Text)
+	}
+}
+
+// keycapImage rasterizes the chip the way the QKey widget lays it out, sz
+// pixels tall. The width depends on the chip, like in the GUI.
+func keycapImage(key Key, sz int, opacity float64) image.Image {
+	labelPx, smallPx := sz/4, sz/4
+	if sz >= 64 {
+		labelPx, smallPx = sz/2, sz/8
+	} else if sz >= 32 {
+		labelPx, smallPx = sz/3, sz/6
+	}
+	face := rasterFace(labelPx)
+	small := rasterFace(smallPx)
+	if face == nil || small == nil {
+		return nil
+	}
+
+	label, shifted := key.Label()
+	code := []Segment{}
+	switch {
+	case key.Action != "":
+		code = append(code, Segment{Text: key.Action, Color: &sakuraIris})
+	case key.Text, key.Found:
+	case strings.HasPrefix(key.Name, "KEY_"):
+		code = append(code, Segment{Text: fmt.Sprintf("key %d", key.Code)})
+		label = []Segment{{Text: key.Name[len("KEY_"):], Color: &sakuraTree}}
+	case strings.HasPrefix(key.Name, "BTN_"):
+		code = append(code, Segment{Text: fmt.Sprintf("btn %d", key.Code)})
+		label = []Segment{{Text: key.Name[len("BTN_"):], Color: &sakuraTree}}
+	default:
+		code = append(code, Segment{Text: fmt.Sprint(key.Code)})
+		label = []Segment{{Text: key.Name, Color: &sakuraTree}}
+	}
+
+	width := sz
+	labelW := measureSegments(face, label)
+	if key.Text {
+		width = max(sz, labelW+16)
+	} else if !key.Found {
+		width = sz * 2
+		if labelW > width-8 {
+			face = rasterFace(max(1, labelPx*(width-8)/labelW))
+			labelW = measureSegments(face, label)
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, sz))
+	fg := textColor(sakuraBg)
+	fillRounded(img, img.Rect, themeRadius, hexColor(sakuraBg, opacity))
+
+	smallAscent := small.Metrics().Ascent.Ceil()
+	drawSegments(img, small, code, 4, 2+smallAscent, fg, opacity)
+	if key.Count > 1 {
+		count := []Segment{{Text: fmt.Sprintf("x%d", key.Count), Color: &sakuraRose}}
+		drawSegments(img, small, count, width-4-measureSegments(small, count), 2+smallAscent, fg, opacity)
+	}
+
+	metrics := face.Metrics()
+	baseline := (sz+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2 + 1
+	drawSegments(img, face, label, (width-labelW)/2, baseline, fg, opacity)
+
+	bulbs := []string{"", "", "", ""}
+	if key.Held.Shift && !shifted {
+		bulbs[0] = modChar.Shift
+	}
+	if key.Held.Meta {
+		bulbs[1] = modChar.Meta
+	}
+	if key.Held.Ctrl {
+		bulbs[2] = modChar.Ctrl
+	}
+	if key.Held.Alt {
+		bulbs[3] = modChar.Alt
+	}
+	slot := (width - 8) / len(bulbs)
+	for i, bulb := range bulbs {
+		if bulb == "" {
+			continue
+		}
+		segs := []Segment{modSegment(bulb)}
+		x := 4 + slot*i + (slot-measureSegments(small, segs))/2
+		drawSegments(img, small, segs, x, sz-2-small.Metrics().Descent.Ceil(), fg, opacity)
+	}
+	return img
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	reducedMotion     bool
+	_flagReduceMotion *bool
+)
+
+// desktopReducesMotion reports whether GNOME or KDE have animations turned
+// off, for whoever ran kbviz rather than root
+func desktopReducesMotion() bool {
+	out, err := gsettings("get", "org.gnome.desktop.interface", "enable-animations").Output()
+	if err == nil && strings.TrimSpace(string(out)) == "false" {
+		return true
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := userHome()
+		if err != nil {
+			return false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	file, err := os.Open(filepath.Join(dir, "kdeglobals"))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+		} else if key, val, ok := strings.Cut(line, "="); ok && section == "[KDE]" &&
+			strings.TrimSpace(key) == "AnimationDurationFactor" {
+			return strings.TrimSpace(val) == "0"
+		}
+	}
+	return false
+}
+
+// gsettings runs gsettings as whoever ran kbviz, on their session bus
+func gsettings(args ...string) *exec.Cmd {
+	u := invokingUser()
+	if u == nil {
+		return exec.Command("gsettings", args...)
+	}
+
+	cmd := exec.Command("runuser", append([]string{"-u", u.Username, "--", "gsettings"}, args...)...)
+	cmd.Env = os.Environ()
+	if os.Getenv("XDG_RUNTIME_DIR") == "" {
+		cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR=/run/user/"+u.Uid)
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		cmd.Env = append(cmd.Env, "DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/"+u.Uid+"/bus")
+	}
+	return cmd
+}
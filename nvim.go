@@ -0,0 +1,738 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/holoplot/go-evdev"
+)
+
+/*
+	Minimal msgpack-RPC client for Neovim. Only the parts of the spec that
+	Neovim actually sends are implemented: requests go out as
+	[0, msgid, method, params], responses come back as
+	[1, msgid, error, result], and notifications as [2, method, params].
+*/
+
+type mpExt struct {
+	Type int8
+	Data []byte
+}
+
+func mpEncode(buf *bytes.Buffer, val any) error {
+	switch v := val.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		return mpEncode(buf, int64(v))
+	case uint32:
+		return mpEncode(buf, int64(v))
+	case int64:
+		if v >= -32 && v < 128 {
+			buf.WriteByte(byte(v))
+		} else {
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case string:
+		n := len(v)
+		if n < 32 {
+			buf.WriteByte(0xa0 | byte(n))
+		} else if n < 256 {
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		} else if n < 65536 {
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		} else {
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(v)
+	case []any:
+		n := len(v)
+		if n < 16 {
+			buf.WriteByte(0x90 | byte(n))
+		} else if n < 65536 {
+			buf.WriteByte(0xdc)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		} else {
+			buf.WriteByte(0xdd)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		for _, item := range v {
+			if err := mpEncode(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		n := len(v)
+		if n < 16 {
+			buf.WriteByte(0x80 | byte(n))
+		} else if n < 65536 {
+			buf.WriteByte(0xde)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		} else {
+			buf.WriteByte(0xdf)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		for key, item := range v {
+			mpEncode(buf, key)
+			if err := mpEncode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode `%T'", val)
+	}
+	return nil
+}
+
+func mpReadN(r *bufio.Reader, n int) ([]byte, error) {
+	ret := make([]byte, n)
+	_, err := io.ReadFull(r, ret)
+	return ret, err
+}
+
+func mpReadUint(r *bufio.Reader, size int) (uint64, error) {
+	b, err := mpReadN(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var ret uint64
+	for _, c := range b {
+		ret = ret<<8 | uint64(c)
+	}
+	return ret, nil
+}
+
+func mpDecode(r *bufio.Reader) (any, error) {
+	head, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case head <= 0x7f:
+		return int64(head), nil
+	case head >= 0xe0:
+		return int64(int8(head)), nil
+	case head&0xf0 == 0x80:
+		return mpDecodeMap(r, int(head&0x0f))
+	case head&0xf0 == 0x90:
+		return mpDecodeArray(r, int(head&0x0f))
+	case head&0xe0 == 0xa0:
+		b, err := mpReadN(r, int(head&0x1f))
+		return string(b), err
+	}
+
+	switch head {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := map[byte]int{0xc4: 1, 0xc5: 2, 0xc6: 4, 0xd9: 1, 0xda: 2, 0xdb: 4}[head]
+		n, err := mpReadUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		b, err := mpReadN(r, int(n))
+		if head >= 0xd9 {
+			return string(b), err
+		}
+		return b, err
+	case 0xca:
+		n, err := mpReadUint(r, 4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := mpReadUint(r, 8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := mpReadUint(r, 1<<(head-0xcc))
+		return int64(n), err
+	case 0xd0:
+		n, err := mpReadUint(r, 1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := mpReadUint(r, 2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := mpReadUint(r, 4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := mpReadUint(r, 8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return mpDecodeExt(r, 1<<(head-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := mpReadUint(r, 1<<(head-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return mpDecodeExt(r, int(n))
+	case 0xdc, 0xdd:
+		n, err := mpReadUint(r, 2<<(head-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return mpDecodeArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := mpReadUint(r, 2<<(head-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return mpDecodeMap(r, int(n))
+	}
+
+	return nil, fmt.Errorf("unknown msgpack type `0x%02x'", head)
+}
+
+func mpDecodeExt(r *bufio.Reader, n int) (any, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := mpReadN(r, n)
+	return mpExt{Type: int8(t), Data: b}, err
+}
+
+func mpDecodeArray(r *bufio.Reader, n int) (any, error) {
+	ret := make([]any, n)
+	for i := range ret {
+		item, err := mpDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = item
+	}
+	return ret, nil
+}
+
+func mpDecodeMap(r *bufio.Reader, n int) (any, error) {
+	ret := map[string]any{}
+	for range n {
+		key, err := mpDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		item, err := mpDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		ret[fmt.Sprint(key)] = item
+	}
+	return ret, nil
+}
+
+type nvimResponse struct {
+	Err    any
+	Result any
+}
+
+type nvimMapping struct {
+	Lhs  []string
+	Rhs  string
+	Desc string
+}
+
+type NvimClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+
+	msgid     uint32
+	pending   map[uint32]chan nvimResponse
+	pendingMu sync.Mutex
+	// Closed once the connection drops, with why in err
+	done chan struct{}
+	err  error
+
+	Channel int64
+
+	stateMu sync.Mutex
+	Mode    string
+	maps    []nvimMapping
+	seq     []string
+}
+
+var (
+	nvim      *NvimClient
+	_flagNvim *string
+)
+
+const nvimAutocmds = `
+local chan = ...
+local group = vim.api.nvim_create_augroup("kbviz_" .. chan, { clear = true })
+vim.api.nvim_create_autocmd("ModeChanged", {
+	group = group,
+	callback = function()
+		vim.rpcnotify(chan, "kbviz_mode", vim.api.nvim_get_mode().mode)
+	end,
+})
+vim.api.nvim_create_autocmd({ "BufEnter", "LspAttach" }, {
+	group = group,
+	callback = function()
+		vim.rpcnotify(chan, "kbviz_keymap")
+	end,
+})
+`
+
+func DialNvim(addr string) (*NvimClient, error) {
+	network := "unix"
+	if !strings.Contains(addr, "/") && strings.Contains(addr, ":") {
+		network = "tcp"
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	nv := &NvimClient{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		pending: map[uint32]chan nvimResponse{},
+		done:    make(chan struct{}),
+	}
+	go nv.loop()
+
+	info, err := nv.Call("nvim_get_api_info")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if parts, ok := info.([]any); ok && len(parts) > 0 {
+		nv.Channel, _ = parts[0].(int64)
+	}
+
+	_, err = nv.Call("nvim_exec_lua", nvimAutocmds, []any{nv.Channel})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	state, err := nv.Call("nvim_get_mode")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	mode := ""
+	if m, ok := state.(map[string]any); ok {
+		mode, _ = m["mode"].(string)
+	}
+	nv.SetMode(mode)
+
+	return nv, nil
+}
+
+func (nv *NvimClient) Close() error {
+	return nv.conn.Close()
+}
+
+func (nv *NvimClient) Call(method string, params ...any) (any, error) {
+	nv.pendingMu.Lock()
+	nv.msgid++
+	id := nv.msgid
+	ch := make(chan nvimResponse, 1)
+	nv.pending[id] = ch
+	nv.pendingMu.Unlock()
+
+	if params == nil {
+		params = []any{}
+	}
+	buf := bytes.Buffer{}
+	err := mpEncode(&buf, []any{0, id, method, params})
+	if err == nil {
+		nv.writeMu.Lock()
+		_, err = nv.conn.Write(buf.Bytes())
+		nv.writeMu.Unlock()
+	}
+	if err != nil {
+		nv.pendingMu.Lock()
+		delete(nv.pending, id)
+		nv.pendingMu.Unlock()
+		return nil, err
+	}
+
+	var resp nvimResponse
+	select {
+	case resp = <-ch:
+	case <-nv.done:
+		// The reply may have come in just before the connection dropped
+		select {
+		case resp = <-ch:
+		default:
+			return nil, nv.err
+		}
+	}
+	if resp.Err != nil {
+		if parts, ok := resp.Err.([]any); ok && len(parts) == 2 {
+			return nil, fmt.Errorf("nvim: %s: %v", method, parts[1])
+		}
+		return nil, fmt.Errorf("nvim: %s: %v", method, resp.Err)
+	}
+	return resp.Result, nil
+}
+
+// loop reads replies and notifications until the connection drops, then
+// fails every call still waiting on a reply
+func (nv *NvimClient) loop() {
+	nv.err = fmt.Errorf("nvim: connection closed")
+	defer func() {
+		nv.pendingMu.Lock()
+		clear(nv.pending)
+		close(nv.done)
+		nv.pendingMu.Unlock()
+	}()
+
+	for {
+		msg, err := mpDecode(nv.reader)
+		if err != nil {
+			if err != io.EOF {
+				nv.err = fmt.Errorf("nvim: %w", err)
+				fmt.Fprintf(os.Stderr, "nvim: \x1b[91;1m%s\x1b[0m\n", err.Error())
+			}
+			return
+		}
+
+		parts, ok := msg.([]any)
+		if !ok || len(parts) < 3 {
+			continue
+		}
+		kind, _ := parts[0].(int64)
+
+		switch {
+		case kind == 1 && len(parts) == 4:
+			id, _ := parts[1].(int64)
+			nv.pendingMu.Lock()
+			ch, ok := nv.pending[uint32(id)]
+			delete(nv.pending, uint32(id))
+			nv.pendingMu.Unlock()
+			if ok {
+				ch <- nvimResponse{Err: parts[2], Result: parts[3]}
+			}
+		case kind == 2:
+			method, _ := parts[1].(string)
+			params, _ := parts[2].([]any)
+			go nv.handle(method, params)
+		}
+	}
+}
+
+func (nv *NvimClient) handle(method string, params []any) {
+	switch method {
+	case "kbviz_mode":
+		if len(params) > 0 {
+			mode, _ := params[0].(string)
+			nv.SetMode(mode)
+		}
+	case "kbviz_keymap":
+		nv.stateMu.Lock()
+		mode := nv.Mode
+		nv.stateMu.Unlock()
+		nv.refresh(mode)
+	}
+}
+
+func (nv *NvimClient) SetMode(mode string) {
+	nv.stateMu.Lock()
+	changed := nv.maps == nil || nvimMapMode(nv.Mode) != nvimMapMode(mode)
+	nv.Mode = mode
+	nv.seq = nil
+	nv.stateMu.Unlock()
+
+	if changed {
+		nv.refresh(mode)
+	}
+}
+
+func (nv *NvimClient) refresh(mode string) {
+	short := nvimMapMode(mode)
+	maps := []nvimMapping{}
+
+	// Buffer-local mappings shadow global ones, so they go first
+	for _, call := range [][]any{
+		{"nvim_buf_get_keymap", 0, short},
+		{"nvim_get_keymap", short},
+	} {
+		ret, err := nv.Call(call[0].(string), call[1:]...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "nvim: \x1b[91;1m%s\x1b[0m\n", err.Error())
+			continue
+		}
+		list, _ := ret.([]any)
+		for _, item := range list {
+			m, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			lhs, _ := m["lhs"].(string)
+			rhs, _ := m["rhs"].(string)
+			desc, _ := m["desc"].(string)
+			if lhs == "" {
+				continue
+			}
+			maps = append(maps, nvimMapping{Lhs: nvimTokens(lhs), Rhs: rhs, Desc: desc})
+		}
+	}
+
+	nv.stateMu.Lock()
+	nv.maps = maps
+	nv.stateMu.Unlock()
+}
+
+// Resolve feeds one key into the pending sequence and returns the current
+// mode along with the description of the mapping it completes, if any
+func (nv *NvimClient) Resolve(key *Key) (string, string) {
+	nv.stateMu.Lock()
+	defer nv.stateMu.Unlock()
+
+	tok := nvimNotation(key)
+	if tok == "" {
+		return nv.Mode, ""
+	}
+	nv.seq = append(nv.seq, tok)
+
+	for len(nv.seq) > 0 {
+		prefix := false
+		for _, m := range nv.maps {
+			if len(m.Lhs) < len(nv.seq) || !equalTokens(m.Lhs[:len(nv.seq)], nv.seq) {
+				continue
+			}
+			if len(m.Lhs) == len(nv.seq) {
+				nv.seq = nil
+				if m.Desc != "" {
+					return nv.Mode, m.Desc
+				}
+				return nv.Mode, m.Rhs
+			}
+			prefix = true
+		}
+		if prefix {
+			return nv.Mode, ""
+		}
+		nv.seq = nv.seq[1:]
+	}
+
+	return nv.Mode, ""
+}
+
+func equalTokens(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func nvimMapMode(mode string) string {
+	switch {
+	case mode == "":
+		return "n"
+	case strings.HasPrefix(mode, "no"):
+		return "o"
+	}
+
+	switch mode[0] {
+	case 'i', 'R':
+		return "i"
+	case 'v', 'V', 0x16:
+		return "x"
+	case 's', 'S', 0x13:
+		return "s"
+	case 'c', 'r':
+		return "c"
+	case 't':
+		return "t"
+	}
+	return "n"
+}
+
+var nvimAliases = map[string]string{
+	"<lt>":        "<",
+	"<bar>":       "|",
+	"<bslash>":    "\\",
+	" ":           "<space>",
+	"<return>":    "<cr>",
+	"<enter>":     "<cr>",
+	"<backspace>": "<bs>",
+	"<delete>":    "<del>",
+	"<insert>":    "<ins>",
+	"<nl>":        "<c-j>",
+	"<tab>":       "<tab>",
+	"<kenter>":    "<cr>",
+}
+
+var nvimSpecial = regexp.MustCompile(`^<([a-zA-Z0-9-]+|(?:[a-zA-Z]-)+.)>`)
+
+// nvimModOrder puts the modifiers of a lowercased <...> token in the order
+// nvimNotation writes them, as Neovim hands back <M-C-x> for <C-M-x>
+func nvimModOrder(tok string) string {
+	inner := tok[1 : len(tok)-1]
+	mods := []string{}
+	for len(inner) > 2 && inner[1] == '-' {
+		mod := inner[:2]
+		if mod == "a-" {
+			mod = "m-"
+		}
+		mods = append(mods, mod)
+		inner = inner[2:]
+	}
+	slices.Sort(mods)
+	return "<" + strings.Join(slices.Compact(mods), "") + inner + ">"
+}
+
+func nvimTokens(lhs string) []string {
+	ret := []string{}
+	for len(lhs) > 0 {
+		tok := ""
+		if m := nvimSpecial.FindString(lhs); m != "" {
+			tok = nvimModOrder(strings.ToLower(m))
+			lhs = lhs[len(m):]
+		} else {
+			_, sz := utf8.DecodeRuneInString(lhs)
+			tok = lhs[:sz]
+			lhs = lhs[sz:]
+		}
+		if alias, ok := nvimAliases[tok]; ok {
+			tok = alias
+		}
+		ret = append(ret, tok)
+	}
+	return ret
+}
+
+var nvimNames = map[evdev.EvCode]string{
+	evdev.KEY_ESC:       "esc",
+	evdev.KEY_ENTER:     "cr",
+	evdev.KEY_KPENTER:   "cr",
+	evdev.KEY_TAB:       "tab",
+	evdev.KEY_BACKSPACE: "bs",
+	evdev.KEY_DELETE:    "del",
+	evdev.KEY_INSERT:    "ins",
+	evdev.KEY_SPACE:     "space",
+	evdev.KEY_LEFT:      "left",
+	evdev.KEY_RIGHT:     "right",
+	evdev.KEY_UP:        "up",
+	evdev.KEY_DOWN:      "down",
+	evdev.KEY_HOME:      "home",
+	evdev.KEY_END:       "end",
+	evdev.KEY_PAGEUP:    "pageup",
+	evdev.KEY_PAGEDOWN:  "pagedown",
+}
+
+var nvimChars = map[evdev.EvCode]string{
+	evdev.KEY_1:          "1",
+	evdev.KEY_2:          "2",
+	evdev.KEY_3:          "3",
+	evdev.KEY_4:          "4",
+	evdev.KEY_5:          "5",
+	evdev.KEY_6:          "6",
+	evdev.KEY_7:          "7",
+	evdev.KEY_8:          "8",
+	evdev.KEY_9:          "9",
+	evdev.KEY_0:          "0",
+	evdev.KEY_MINUS:      "-",
+	evdev.KEY_EQUAL:      "=",
+	evdev.KEY_LEFTBRACE:  "[",
+	evdev.KEY_RIGHTBRACE: "]",
+	evdev.KEY_SEMICOLON:  ";",
+	evdev.KEY_APOSTROPHE: "'",
+	evdev.KEY_GRAVE:      "`",
+	evdev.KEY_BACKSLASH:  "\\",
+	evdev.KEY_COMMA:      ",",
+	evdev.KEY_DOT:        ".",
+	evdev.KEY_SLASH:      "/",
+}
+
+func nvimNotation(key *Key) string {
+	if key.Type != evdev.EV_KEY {
+		return ""
+	}
+
+	name, special := nvimNames[key.Code]
+	char := ""
+	if !special {
+		if c, ok := nvimChars[key.Code]; ok {
+			char = c
+		} else if len(key.Name) == len("KEY_A") && strings.HasPrefix(key.Name, "KEY_") {
+			char = strings.ToLower(key.Name[len("KEY_"):])
+		} else if strings.HasPrefix(key.Name, "KEY_F") {
+			name = strings.ToLower(key.Name[len("KEY_"):])
+			special = true
+		} else {
+			return ""
+		}
+	}
+
+	mods := ""
+	if key.Held.Ctrl {
+		mods += "c-"
+	}
+	if key.Held.Meta {
+		mods += "d-"
+	}
+	if key.Held.Alt {
+		mods += "m-"
+	}
+
+	if special {
+		if key.Held.Shift {
+			mods += "s-"
+		}
+		return "<" + mods + name + ">"
+	}
+
+	if key.Held.Shift {
+		if shift, ok := shifts[char]; ok {
+			char = shift
+		}
+		if mods != "" {
+			char = strings.ToLower(char)
+			mods += "s-"
+		}
+	}
+
+	if mods == "" {
+		return char
+	}
+	return "<" + mods + char + ">"
+}
+
+func connectNvim() {
+	addr := os.Getenv("NVIM")
+	if _flagNvim != nil && *_flagNvim != "" {
+		addr = *_flagNvim
+	}
+	if addr == "" || addr == "off" {
+		return
+	}
+
+	nv, err := DialNvim(addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nvim: \x1b[91;1m%s\x1b[0m [%s]\n", err.Error(), addr)
+		return
+	}
+	nvim = nv
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// fakeNvim answers requests on the socket the way Neovim would, from a
+// table of results by method
+func fakeNvim(t *testing.T, results map[string]any) string {
+	t.Helper()
+	addr := filepath.Join(t.TempDir(), "nvim.sock")
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			msg, err := mpDecode(reader)
+			if err != nil {
+				return
+			}
+			parts := msg.([]any)
+			method := parts[2].(string)
+			result, ok := results[method]
+			var reply []any
+			if ok {
+				reply = []any{1, parts[1], nil, result}
+			} else {
+				reply = []any{1, parts[1], []any{0, "unknown method " + method}, nil}
+			}
+			buf := bytes.Buffer{}
+			if err := mpEncode(&buf, reply); err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Write(buf.Bytes())
+		}
+	}()
+	return addr
+}
+
+func nvimKey(code evdev.EvCode, held ModSet[bool]) *Key {
+	return &Key{Type: evdev.EV_KEY, Code: code, Name: evdev.CodeName(evdev.EV_KEY, code), Held: held}
+}
+
+func TestNvimResolve(t *testing.T) {
+	addr := fakeNvim(t, map[string]any{
+		"nvim_get_api_info":   []any{7, map[string]any{}},
+		"nvim_exec_lua":       nil,
+		"nvim_get_mode":       map[string]any{"mode": "n", "blocking": false},
+		"nvim_buf_get_keymap": []any{map[string]any{"lhs": "gd", "rhs": "<Cmd>lua vim.lsp.buf.definition()<CR>"}},
+		"nvim_get_keymap": []any{
+			map[string]any{"lhs": "<Space>ff", "rhs": ":Telescope find_files<CR>", "desc": "Find files"},
+			map[string]any{"lhs": "<C-W>v", "rhs": ":vsplit<CR>"},
+			// Neovim's own order, not the one the mapping was made with
+			map[string]any{"lhs": "<M-C-X>", "rhs": ":close<CR>"},
+			map[string]any{"lhs": "<S-C-F5>", "rhs": ":make<CR>"},
+			map[string]any{"lhs": "<A-D-j>", "rhs": ":cnext<CR>"},
+		},
+	})
+
+	nv, err := DialNvim(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nv.Close()
+	if nv.Channel != 7 {
+		t.Errorf("channel %d, want 7", nv.Channel)
+	}
+
+	for _, tt := range []struct {
+		keys   []*Key
+		action string
+	}{
+		{[]*Key{nvimKey(evdev.KEY_G, ModSet[bool]{}), nvimKey(evdev.KEY_D, ModSet[bool]{})}, "<Cmd>lua vim.lsp.buf.definition()<CR>"},
+		{[]*Key{nvimKey(evdev.KEY_SPACE, ModSet[bool]{}), nvimKey(evdev.KEY_F, ModSet[bool]{}), nvimKey(evdev.KEY_F, ModSet[bool]{})}, "Find files"},
+		{[]*Key{nvimKey(evdev.KEY_W, ModSet[bool]{Ctrl: true}), nvimKey(evdev.KEY_V, ModSet[bool]{})}, ":vsplit<CR>"},
+		{[]*Key{nvimKey(evdev.KEY_X, ModSet[bool]{Ctrl: true, Alt: true})}, ":close<CR>"},
+		{[]*Key{nvimKey(evdev.KEY_F5, ModSet[bool]{Ctrl: true, Shift: true})}, ":make<CR>"},
+		{[]*Key{nvimKey(evdev.KEY_J, ModSet[bool]{Alt: true, Meta: true})}, ":cnext<CR>"},
+		// A key that isn't part of any mapping drops the sequence so far
+		{[]*Key{nvimKey(evdev.KEY_G, ModSet[bool]{}), nvimKey(evdev.KEY_X, ModSet[bool]{}), nvimKey(evdev.KEY_D, ModSet[bool]{})}, ""},
+	} {
+		action := ""
+		for _, key := range tt.keys {
+			var mode string
+			mode, action = nv.Resolve(key)
+			if mode != "n" {
+				t.Errorf("mode %q, want n", mode)
+			}
+		}
+		if action != tt.action {
+			t.Errorf("%s: action %q, want %q", nvimNotation(tt.keys[0]), action, tt.action)
+		}
+		nv.SetMode("n")
+	}
+}
+
+func TestNvimNotation(t *testing.T) {
+	for _, tt := range []struct {
+		code evdev.EvCode
+		held ModSet[bool]
+		want string
+	}{
+		{evdev.KEY_A, ModSet[bool]{}, "a"},
+		{evdev.KEY_A, ModSet[bool]{Shift: true}, "A"},
+		{evdev.KEY_A, ModSet[bool]{Ctrl: true}, "<c-a>"},
+		{evdev.KEY_A, ModSet[bool]{Ctrl: true, Shift: true}, "<c-s-a>"},
+		{evdev.KEY_1, ModSet[bool]{Shift: true}, "!"},
+		{evdev.KEY_SLASH, ModSet[bool]{}, "/"},
+		{evdev.KEY_ESC, ModSet[bool]{}, "<esc>"},
+		{evdev.KEY_ENTER, ModSet[bool]{Alt: true}, "<m-cr>"},
+		{evdev.KEY_TAB, ModSet[bool]{Shift: true}, "<s-tab>"},
+		{evdev.KEY_F5, ModSet[bool]{Meta: true}, "<d-f5>"},
+		{evdev.KEY_X, ModSet[bool]{Ctrl: true, Alt: true, Meta: true, Shift: true}, "<c-d-m-s-x>"},
+		{evdev.KEY_LEFTSHIFT, ModSet[bool]{}, ""},
+	} {
+		if got := nvimNotation(nvimKey(tt.code, tt.held)); got != tt.want {
+			t.Errorf("%s %+v: got %q, want %q", evdev.CodeName(evdev.EV_KEY, tt.code), tt.held, got, tt.want)
+		}
+	}
+
+	if got := nvimNotation(&Key{Type: evdev.EV_REL, Code: evdev.REL_X}); got != "" {
+		t.Errorf("EV_REL: got %q, want nothing", got)
+	}
+}
+
+func TestNvimDropped(t *testing.T) {
+	client, server := net.Pipe()
+	nv := &NvimClient{
+		conn:    client,
+		reader:  bufio.NewReader(client),
+		pending: map[uint32]chan nvimResponse{},
+		done:    make(chan struct{}),
+	}
+	go nv.loop()
+
+	// The server reads the request and hangs up without replying
+	go func() {
+		mpDecode(bufio.NewReader(server))
+		server.Close()
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := nv.Call("nvim_get_mode")
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("call succeeded on a dropped connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call blocked on a dropped connection")
+	}
+
+	if _, err := nv.Call("nvim_get_mode"); err == nil {
+		t.Error("call succeeded after the connection dropped")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Anchor places the window against a side of the screen: -1 is left or
+// top, 0 is centered and 1 is right or bottom
+type Anchor struct {
+	X, Y int
+}
+
+var anchors = map[string]Anchor{
+	"top-left":     {-1, -1},
+	"top":          {0, -1},
+	"top-right":    {1, -1},
+	"left":         {-1, 0},
+	"center":       {0, 0},
+	"right":        {1, 0},
+	"bottom-left":  {-1, 1},
+	"bottom":       {0, 1},
+	"bottom-right": {1, 1},
+}
+
+var (
+	overlayMode       bool
+	clickThrough      bool
+	windowAnchor      *Anchor
+	anchorMargin      = 16
+	targetScreen      string
+	_flagOverlay      *bool
+	_flagClickThrough *bool
+	_flagMargin       *uint
+	_flagScreen       *string
+)
+
+func applyAnchor(val string) error {
+	anchor, ok := anchors[strings.ToLower(val)]
+	if !ok {
+		return fmt.Errorf("anchor `%s' doesn't exist (top-left, top, top-right, left, center, right, bottom-left, bottom, bottom-right)", val)
+	}
+	windowAnchor = &anchor
+	return nil
+}
+
+// Place positions a w×h window inside the screen area, keeping the margin
+// from whichever edges it's anchored to
+func (a Anchor) Place(x, y, width, height, w, h int) (int, int) {
+	place := func(side, start, size, length int) int {
+		switch side {
+		case -1:
+			return start + anchorMargin
+		case 1:
+			return start + size - length - anchorMargin
+		}
+		return start + (size-length)/2
+	}
+	return place(a.X, x, width, w), place(a.Y, y, height, h)
+}
+
+type Geometry struct {
+	X, Y, W, H int
+}
+
+func geometryPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := userHome()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "kbviz", "geometry")
+}
+
+// loadGeometry reads back where the window was when kbviz last exited
+func loadGeometry() (Geometry, bool) {
+	geo := Geometry{}
+	data, err := os.ReadFile(geometryPath())
+	if err != nil {
+		return geo, false
+	}
+	_, err = fmt.Sscanf(string(data), "%d %d %d %d", &geo.X, &geo.Y, &geo.W, &geo.H)
+	return geo, err == nil && geo.W > 0 && geo.H > 0
+}
+
+func saveGeometry(geo Geometry) error {
+	path := geometryPath()
+	if path == "" {
+		return fmt.Errorf("nowhere to save the window geometry")
+	}
+	return writeUserFile(path, []byte(fmt.Sprintf("%d %d %d %d\n", geo.X, geo.Y, geo.W, geo.H)))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// invokingUser is who ran kbviz through sudo or pkexec, nil when it's not
+// running as root on someone else's behalf
+var invokingUser = sync.OnceValue(func() *user.User {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	for _, name := range []string{"PKEXEC_UID", "SUDO_UID"} {
+		uid := os.Getenv(name)
+		if uid == "" || uid == "0" {
+			continue
+		}
+		if u, err := user.LookupId(uid); err == nil {
+			return u
+		}
+	}
+	return nil
+})
+
+// userHome is the home directory of whoever ran kbviz, not root's when it
+// was escalated
+func userHome() (string, error) {
+	if u := invokingUser(); u != nil && u.HomeDir != "" {
+		return u.HomeDir, nil
+	}
+	return os.UserHomeDir()
+}
+
+// writeUserFile is os.WriteFile making the directories the file goes in.
+// When kbviz was escalated, it's written by a shell running as whoever ran
+// it, since as root a symlink they left in the way would let them overwrite
+// any file on the system
+func writeUserFile(path string, data []byte) error {
+	u := invokingUser()
+	if u == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0o644)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("/bin/sh", "-c", `mkdir -p -- "$1" && cat > "$2"`, "sh", filepath.Dir(path), path)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+	}
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
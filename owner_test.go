@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestWriteUserFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "kbviz", "geometry")
+	if err := writeUserFile(path, []byte("1 2 3 4\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeUserFile(path, []byte("5 6 7 8\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "5 6 7 8\n" {
+		t.Errorf("read back %q", data)
+	}
+}
+
+func TestWriteUserFileSymlink(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip(err)
+	}
+	oldUser := invokingUser
+	invokingUser = func() *user.User { return nobody }
+	t.Cleanup(func() { invokingUser = oldUser })
+
+	// The user's own directory, with a link they planted to a file only
+	// root can write
+	root := t.TempDir()
+	for _, dir := range []string{filepath.Dir(root), root} {
+		if err := os.Chmod(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(root, "secret")
+	if err := os.WriteFile(secret, []byte("root only\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(root, "home")
+	if err := os.Mkdir(home, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(home, "geometry")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(home, "up")); err != nil {
+		t.Fatal(err)
+	}
+	uid, _ := strconv.Atoi(nobody.Uid)
+	gid, _ := strconv.Atoi(nobody.Gid)
+	if err := os.Chown(home, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(home, "geometry"),
+		filepath.Join(home, "up", "secret"),
+	} {
+		if err := writeUserFile(path, []byte("1 2 3 4\n")); err == nil {
+			t.Errorf("wrote through %s", path)
+		}
+	}
+	if data, _ := os.ReadFile(secret); string(data) != "root only\n" {
+		t.Errorf("secret is now %q", data)
+	}
+
+	path := filepath.Join(home, "state", "kbviz", "geometry")
+	if err := writeUserFile(path, []byte("1 2 3 4\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Dir(path), path} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner := info.Sys().(*syscall.Stat_t).Uid; int(owner) != uid {
+			t.Errorf("%s is owned by %d, want %d", p, owner, uid)
+		}
+	}
+}
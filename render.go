@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Renderer interface {
+	// Capacity is the most chips that could be on screen at once, or zero
+	// when the renderer wants the whole history
+	Capacity() int
+	// Render draws a snapshot of the newest chips, oldest first
+	Render(snap []Key)
+}
+
+// ChipObserver is implemented by renderers that want to hear about every
+// processed key, not just the resulting history
+type ChipObserver interface {
+	Chip(chip Key)
+}
+
+// Lifecycle is implemented by renderers that take over the output and must
+// hand it back cleanly on exit
+type Lifecycle interface {
+	Start() error
+	Stop()
+}
+
+var renderer Renderer = &TermRenderer{}
+
+var formats = map[string]func() Renderer{
+	"term":     func() Renderer { return &TermRenderer{} },
+	"tui":      func() Renderer { return NewTUIRenderer() },
+	"keyboard": func() Renderer { return &KeyboardRenderer{} },
+	"jsonl":    func() Renderer { return NewJSONRenderer(os.Stdout) },
+	"waybar":   func() Renderer { return NewStatusRenderer(os.Stdout, "waybar") },
+	"i3bar":    func() Renderer { return NewStatusRenderer(os.Stdout, "i3bar") },
+	"polybar":  func() Renderer { return NewStatusRenderer(os.Stdout, "polybar") },
+	"tmux":     func() Renderer { return NewStatusRenderer(os.Stdout, "tmux") },
+}
+
+func applyFormat(val string) error {
+	format, ok := formats[strings.ToLower(val)]
+	if !ok {
+		return fmt.Errorf("format `%s' doesn't exist", val)
+	}
+	renderer = format()
+	return nil
+}
+
+// Orientation is the direction the strip runs in, starting from the newest
+// chip
+type Orientation int
+
+const (
+	RightToLeft Orientation = iota
+	LeftToRight
+	TopToBottom
+	BottomToTop
+)
+
+var orientations = map[string]Orientation{
+	"rtl": RightToLeft,
+	"ltr": LeftToRight,
+	"ttb": TopToBottom,
+	"btt": BottomToTop,
+}
+
+var orientation = RightToLeft
+
+func applyOrientation(val string) error {
+	o, ok := orientations[strings.ToLower(val)]
+	if !ok {
+		return fmt.Errorf("orientation `%s' doesn't exist (rtl, ltr, ttb, btt)", val)
+	}
+	orientation = o
+	return nil
+}
+
+func (o Orientation) Vertical() bool {
+	return o == TopToBottom || o == BottomToTop
+}
+
+func Snapshot(n int) []Key {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	start := 0
+	if n > 0 {
+		start = max(0, history.Len()-n)
+	}
+	snap := make([]Key, 0, history.Len()-start)
+	for i := start; i < history.Len(); i++ {
+		snap = append(snap, *history.At(i))
+	}
+	return snap
+}
+
+func PrintHistory() {
+	renderer.Render(Snapshot(renderer.Capacity()))
+}
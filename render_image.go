@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/png"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type GraphicsMode int
+
+const (
+	GraphicsNone GraphicsMode = iota
+	GraphicsKitty
+	GraphicsSixel
+	GraphicsAuto
+)
+
+var graphicsModes = map[string]GraphicsMode{
+	"auto":  GraphicsAuto,
+	"kitty": GraphicsKitty,
+	"sixel": GraphicsSixel,
+	"none":  GraphicsNone,
+}
+
+var graphicsMode = GraphicsNone
+
+func applyGraphics(val string) error {
+	mode, ok := graphicsModes[strings.ToLower(val)]
+	if !ok {
+		return fmt.Errorf("graphics protocol `%s' doesn't exist (auto, kitty, sixel, none)", val)
+	}
+	graphicsMode = mode
+	return nil
+}
+
+// detectGraphics guesses kitty support from the environment and asks the
+// terminal whether it speaks sixel. Must be called with echo off.
+func detectGraphics() GraphicsMode {
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(os.Getenv("TERM"), "kitty") {
+		return GraphicsKitty
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "WezTerm", "ghostty":
+		return GraphicsKitty
+	}
+
+	// Primary device attributes list 4 when sixel is supported
+	reply := queryTerm("\x1b[c", 'c', 200*time.Millisecond)
+	attrs := strings.Split(strings.TrimPrefix(strings.TrimSuffix(reply, "c"), "\x1b[?"), ";")
+	for _, attr := range attrs[min(1, len(attrs)):] {
+		if attr == "4" {
+			return GraphicsSixel
+		}
+	}
+	return GraphicsNone
+}
+
+// queryTerm writes the query and reads the reply up to the final byte,
+// giving up after the timeout
+func queryTerm(query string, final byte, timeout time.Duration) string {
+	os.Stdout.WriteString(query)
+
+	reply := []byte{}
+	buf := make([]byte, 64)
+	deadline := time.Now().Add(timeout)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return ""
+		}
+		fds := []unix.PollFd{{Fd: 0, Events: unix.POLLIN}}
+		if n, err := unix.Poll(fds, int(left.Milliseconds())+1); err != nil || n == 0 {
+			return ""
+		}
+		n, err := unix.Read(0, buf)
+		if err != nil || n == 0 {
+			return ""
+		}
+		reply = append(reply, buf[:n]...)
+		if i := bytes.IndexByte(reply, final); i >= 0 {
+			return string(reply[:i+1])
+		}
+	}
+}
+
+// cellSize is the size of a character cell in pixels, guessed when the
+// terminal doesn't say
+func cellSize() (int, int) {
+	ws, err := unix.IoctlGetWinsize(0, unix.TIOCGWINSZ)
+	if err != nil || ws.Xpixel == 0 || ws.Ypixel == 0 || ws.Col == 0 || ws.Row == 0 {
+		return 8, 16
+	}
+	return int(ws.Xpixel / ws.Col), int(ws.Ypixel / ws.Row)
+}
+
+// kittyImage transmits the image under the id without placing it
+func kittyImage(img image.Image, id int) string {
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		return ""
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	ret := strings.Builder{}
+	for first := true; first || data != ""; first = false {
+		chunk := data[:min(4096, len(data))]
+		data = data[len(chunk):]
+		more := 0
+		if data != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&ret, "\x1b_Ga=t,f=100,q=2,i=%d,m=%d;%s\x1b\\", id, more, chunk)
+		} else {
+			fmt.Fprintf(&ret, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return ret.String()
+}
+
+// kittyPlace puts a transmitted image over cols×rows cells at the cursor
+// without moving it, or moves it there if it's already on screen
+func kittyPlace(id, cols, rows int) string {
+	return fmt.Sprintf("\x1b_Ga=p,q=2,C=1,i=%d,p=1,c=%d,r=%d\x1b\\", id, cols, rows)
+}
+
+func kittyDelete(id int) string {
+	return fmt.Sprintf("\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", id)
+}
+
+// sixelImage encodes the image against the web-safe palette, leaving
+// transparent pixels unset
+func sixelImage(img image.Image) string {
+	bounds := img.Bounds()
+	pal := color.Palette(palette.WebSafe)
+	idx := make([]int, bounds.Dx()*bounds.Dy())
+	used := map[int]bool{}
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			if _, _, _, a := c.RGBA(); a < 0x8000 {
+				idx[y*bounds.Dx()+x] = -1
+				continue
+			}
+			i := pal.Index(c)
+			idx[y*bounds.Dx()+x] = i
+			used[i] = true
+		}
+	}
+
+	ret := strings.Builder{}
+	fmt.Fprintf(&ret, "\x1bP0;1;0q\"1;1;%d;%d", bounds.Dx(), bounds.Dy())
+	for i := range used {
+		r, g, b, _ := pal[i].RGBA()
+		fmt.Fprintf(&ret, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	for band := 0; band < bounds.Dy(); band += 6 {
+		first := true
+		for c := range used {
+			run := byte(0)
+			count := 0
+			line := strings.Builder{}
+			flush := func() {
+				switch {
+				case count == 0:
+				case count > 3:
+					fmt.Fprintf(&line, "!%d%c", count, run)
+				default:
+					line.WriteString(strings.Repeat(string(run), count))
+				}
+			}
+			found := false
+			for x := 0; x < bounds.Dx(); x++ {
+				bits := byte(0)
+				for dy := 0; dy < 6 && band+dy < bounds.Dy(); dy++ {
+					if idx[(band+dy)*bounds.Dx()+x] == c {
+						bits |= 1 << dy
+						found = true
+					}
+				}
+				if ch := 63 + bits; ch == run {
+					count++
+				} else {
+					flush()
+					run = ch
+					count = 1
+				}
+			}
+			if !found {
+				continue
+			}
+			flush()
+			if !first {
+				ret.WriteString("$")
+			}
+			first = false
+			fmt.Fprintf(&ret, "#%d%s", c, line.String())
+		}
+		ret.WriteString("-")
+	}
+	ret.WriteString("\x1b\\")
+	return ret.String()
+}
+
+// kittyBaseID keeps our image ids clear of anything else on screen
+const kittyBaseID = 0x6b620000
+
+// keycapState is everything a keycap image is drawn from, so it's only
+// drawn and sent again when one of them changes
+type keycapState struct {
+	id      uint64
+	char    string
+	count   int
+	opacity int
+	sz      int
+}
+
+// keycapSteps is how many shades of opacity a fading keycap goes through
+const keycapSteps = 16
+
+// keycapCache is a keycap image and what the terminal has of it: the kitty
+// image id it was sent under, or its sixel encoding
+type keycapCache struct {
+	img   image.Image
+	cols  int
+	id    int
+	sixel string
+	// Column the kitty image was last placed at, -1 until it's placed
+	x int
+}
+
+// renderImages places keycap images along the bottom of our area, newest
+// on the right, in the graphics protocol found at startup. Images are kept
+// while they're on screen, so kitty is only sent the new ones and told
+// where to move the rest.
+func (r *TermRenderer) renderImages(snap []Key, w int) {
+	cellW, cellH := cellSize()
+	rows := keycapHeight
+	sz := rows * cellH
+	if r.graphics == GraphicsSixel {
+		// Sixel bands are six pixels tall and mustn't spill into the next line
+		sz -= sz % 6
+	}
+
+	r.mu.Lock()
+	if r.keycaps == nil {
+		r.keycaps = map[keycapState]*keycapCache{}
+	}
+
+	now := time.Now()
+	caps := []keycapState{}
+	used := 0
+	for i := len(snap) - 1; i >= 0; i-- {
+		key := snap[i]
+		if key.Char == "\x00" {
+			continue
+		}
+		state := keycapState{
+			id:      key.ID,
+			char:    key.Char,
+			count:   key.Count,
+			opacity: int(math.Round(key.Opacity(now) * keycapSteps)),
+			sz:      sz,
+		}
+		c, ok := r.keycaps[state]
+		if !ok {
+			img := keycapImage(key, sz, float64(state.opacity)/keycapSteps)
+			if img == nil {
+				break
+			}
+			c = &keycapCache{img: img, cols: (img.Bounds().Dx() + cellW - 1) / cellW, x: -1}
+			r.keycaps[state] = c
+		}
+		if used+c.cols >= w {
+			break
+		}
+		caps = append(caps, state)
+		used += c.cols + 1
+	}
+
+	overlay := strings.Builder{}
+	for state, c := range r.keycaps {
+		if !slices.Contains(caps, state) {
+			if c.id != 0 {
+				overlay.WriteString(kittyDelete(c.id))
+			}
+			delete(r.keycaps, state)
+		}
+	}
+
+	x := w
+	for _, state := range caps {
+		c := r.keycaps[state]
+		x -= c.cols
+		// Redrawing the lines wipes out sixels, so they're all drawn again,
+		// but kitty images stay until they're moved or deleted
+		if r.graphics == GraphicsSixel || c.x != x {
+			overlay.WriteString("\x1b8")
+			if x > 0 {
+				fmt.Fprintf(&overlay, "\x1b[%dC", x)
+			}
+		}
+		switch {
+		case r.graphics == GraphicsSixel:
+			if c.img != nil {
+				c.sixel = sixelImage(c.img)
+				c.img = nil
+			}
+			overlay.WriteString(c.sixel)
+		case c.x != x:
+			if c.img != nil {
+				r.lastImage++
+				c.id = kittyBaseID + r.lastImage%0x10000
+				overlay.WriteString(kittyImage(c.img, c.id))
+				c.img = nil
+			}
+			overlay.WriteString(kittyPlace(c.id, c.cols, rows))
+			c.x = x
+		}
+		x--
+	}
+	r.mu.Unlock()
+
+	lines := make([]string, rows)
+	if r.graphics == GraphicsSixel {
+		// Leave room for the cursor below the images so they don't scroll
+		lines = append(lines, "")
+	}
+	r.drawOverlay(lines, overlay.String())
+}
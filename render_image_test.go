@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// captureStdout returns what f writes to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = wr
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(rd)
+		done <- string(data)
+	}()
+	f()
+	os.Stdout = old
+	wr.Close()
+	return <-done
+}
+
+func TestRenderImagesKitty(t *testing.T) {
+	key := func(id uint64, code evdev.EvCode) Key {
+		char := tokens[evdev.EV_KEY][code]
+		return Key{ID: id, Type: evdev.EV_KEY, Code: code, Char: char, Found: true, Count: 1}
+	}
+	r := &TermRenderer{started: true, graphics: GraphicsKitty}
+	a, b, c := key(1, evdev.KEY_A), key(2, evdev.KEY_B), key(3, evdev.KEY_C)
+
+	for _, tt := range []struct {
+		name                  string
+		snap                  []Key
+		sent, placed, deleted int
+	}{
+		{"first frame", []Key{a, b}, 2, 2, 0},
+		{"nothing changed", []Key{a, b}, 0, 0, 0},
+		{"new key moves the rest", []Key{a, b, c}, 1, 3, 0},
+		{"oldest dropped", []Key{b, c}, 0, 0, 1},
+		{"repeat redraws only that key", []Key{b, {ID: 3, Type: evdev.EV_KEY, Code: evdev.KEY_C, Char: c.Char, Found: true, Count: 2}}, 1, 1, 1},
+	} {
+		out := captureStdout(t, func() { r.renderImages(tt.snap, 80) })
+		sent := strings.Count(out, "a=t,")
+		placed := strings.Count(out, "a=p,")
+		deleted := strings.Count(out, "a=d,")
+		if sent != tt.sent || placed != tt.placed || deleted != tt.deleted {
+			t.Errorf("%s: sent %d, placed %d, deleted %d; want %d, %d, %d",
+				tt.name, sent, placed, deleted, tt.sent, tt.placed, tt.deleted)
+		}
+	}
+	if len(r.keycaps) != 2 {
+		t.Errorf("%d images kept, want 2", len(r.keycaps))
+	}
+}
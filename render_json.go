@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+type jsonChip struct {
+	Time      time.Time `json:"time"`
+	Device    string    `json:"device"`
+	Type      string    `json:"type"`
+	Code      int       `json:"code"`
+	Name      string    `json:"name"`
+	Label     string    `json:"label"`
+	Modifiers []string  `json:"modifiers"`
+	Count     int       `json:"count"`
+	Repeat    bool      `json:"repeat"`
+	Text      bool      `json:"text,omitempty"`
+	Mode      string    `json:"mode,omitempty"`
+	Action    string    `json:"action,omitempty"`
+}
+
+type jsonChipEvent struct {
+	Event string `json:"event"`
+	jsonChip
+}
+
+type jsonHistoryEvent struct {
+	Event string     `json:"event"`
+	Time  time.Time  `json:"time"`
+	Chips []jsonChip `json:"chips"`
+}
+
+func toJSONChip(key Key) jsonChip {
+	mods := []string{}
+	for _, mod := range []struct {
+		held bool
+		name string
+	}{
+		{key.Held.Shift, "shift"},
+		{key.Held.Ctrl, "ctrl"},
+		{key.Held.Alt, "alt"},
+		{key.Held.Meta, "meta"},
+	} {
+		if mod.held {
+			mods = append(mods, mod.name)
+		}
+	}
+
+	label := key.Char
+	if !key.Text {
+		segs, _ := key.Label()
+		label = segmentsText(segs)
+	}
+
+	return jsonChip{
+		Time:      key.Time,
+		Device:    key.Device,
+		Type:      evdev.TypeName(key.Type),
+		Code:      int(key.Code),
+		Name:      key.Name,
+		Label:     label,
+		Modifiers: mods,
+		Count:     key.Count,
+		Repeat:    key.Repeat,
+		Text:      key.Text,
+		Mode:      key.Mode,
+		Action:    key.Action,
+	}
+}
+
+// JSONRenderer writes one JSON object per line: a "chip" event for every
+// processed key and a "history" event whenever the visible chips change
+type JSONRenderer struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	last []byte
+}
+
+func NewJSONRenderer(w io.Writer) *JSONRenderer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONRenderer{enc: enc}
+}
+
+// jsonWindow is how many of the newest chips a history event carries when
+// -max-chips doesn't say, since every change writes them all out again
+const jsonWindow = 16
+
+func (r *JSONRenderer) Capacity() int {
+	if maxChips > 0 {
+		return maxChips
+	}
+	return jsonWindow
+}
+
+func (r *JSONRenderer) Chip(chip Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enc.Encode(jsonChipEvent{Event: "chip", jsonChip: toJSONChip(chip)})
+}
+
+func (r *JSONRenderer) Render(snap []Key) {
+	chips := []jsonChip{}
+	for _, key := range snap {
+		if key.Char != "\x00" {
+			chips = append(chips, toJSONChip(key))
+		}
+	}
+
+	// Fading redraws the same chips many times over, only changes matter
+	state, _ := json.Marshal(chips)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytes.Equal(state, r.last) {
+		return
+	}
+	r.last = state
+
+	r.enc.Encode(jsonHistoryEvent{Event: "history", Time: time.Now(), Chips: chips})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+func TestJSONChipLabel(t *testing.T) {
+	key := func(code evdev.EvCode, held ModSet[bool], action string) Key {
+		char, found := tokens[evdev.EV_KEY][code]
+		return Key{
+			Type: evdev.EV_KEY, Code: code, Name: evdev.CodeName(evdev.EV_KEY, code),
+			Char: char, Found: found, Held: held, Count: 3, Action: action,
+		}
+	}
+	for _, tt := range []struct {
+		name  string
+		key   Key
+		label string
+		mods  []string
+	}{
+		{"plain", key(evdev.KEY_A, ModSet[bool]{}, ""), "a", []string{}},
+		{"modifiers", key(evdev.KEY_A, ModSet[bool]{Ctrl: true, Meta: true}, ""), "a", []string{"ctrl", "meta"}},
+		{"shifted", key(evdev.KEY_1, ModSet[bool]{Shift: true}, ""), "!", []string{"shift"}},
+		{"action", key(evdev.KEY_G, ModSet[bool]{}, "Go to definition"), "g", []string{}},
+		{"text", Key{Type: evdev.EV_KEY, Char: "hello", Text: true, Held: ModSet[bool]{Shift: true}}, "hello", []string{"shift"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chip := toJSONChip(tt.key)
+			if chip.Label != tt.label {
+				t.Errorf("label %q, want %q", chip.Label, tt.label)
+			}
+			if !slices.Equal(chip.Modifiers, tt.mods) {
+				t.Errorf("modifiers %v, want %v", chip.Modifiers, tt.mods)
+			}
+		})
+	}
+}
+
+func TestJSONCapacity(t *testing.T) {
+	oldMax := maxChips
+	t.Cleanup(func() { maxChips = oldMax })
+
+	r := NewJSONRenderer(nil)
+	for _, tt := range []struct{ maxChips, want int }{
+		{0, jsonWindow},
+		{3, 3},
+		{100, 100},
+	} {
+		maxChips = tt.maxChips
+		if got := r.Capacity(); got != tt.want {
+			t.Errorf("max-chips %d: capacity %d, want %d", tt.maxChips, got, tt.want)
+		}
+	}
+}
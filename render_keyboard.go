@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+	"golang.org/x/term"
+)
+
+// KeyboardRenderer draws the keyboard layout with box-drawing characters,
+// lighting up held keys, with the strip underneath
+type KeyboardRenderer struct {
+	TermRenderer
+}
+
+// Box-drawing glyphs by the directions their lines go in
+const (
+	lineUp = 1 << iota
+	lineDown
+	lineLeft
+	lineRight
+)
+
+var boxGlyphs = map[int]rune{
+	lineUp | lineDown:                        '│',
+	lineLeft | lineRight:                     '─',
+	lineDown | lineRight:                     '┌',
+	lineDown | lineLeft:                      '┐',
+	lineUp | lineRight:                       '└',
+	lineUp | lineLeft:                        '┘',
+	lineUp | lineDown | lineRight:            '├',
+	lineUp | lineDown | lineLeft:             '┤',
+	lineDown | lineLeft | lineRight:          '┬',
+	lineUp | lineLeft | lineRight:            '┴',
+	lineUp | lineDown | lineLeft | lineRight: '┼',
+	lineUp:                                   '╵',
+	lineDown:                                 '╷',
+	lineLeft:                                 '╴',
+	lineRight:                                '╶',
+}
+
+type canvasCell struct {
+	lines int
+	text  string
+	// The cell belongs to the inside of a key lit up in this color
+	fill string
+}
+
+// keyLabel is what the key shows in the terminal: its label from `tokens'
+// when it has one, the bottom line of its legend otherwise
+func keyLabel(key KLEKey) string {
+	if key.Mapped {
+		if char, ok := tokens[evdev.EV_KEY][key.Code]; ok && char != "" {
+			return char
+		}
+	}
+	lines := strings.Split(key.Legend, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] != "" {
+			return lines[i]
+		}
+	}
+	return ""
+}
+
+// diagram draws the layout at the given number of columns per key unit.
+// Rotated keys are drawn where they'd be without the rotation.
+func diagram(layout *KeyboardLayout, unit int) []string {
+	cols := int(math.Round(layout.W*float64(unit))) + 1
+	rows := int(math.Round(layout.H*2)) + 1
+	canvas := make([][]canvasCell, rows)
+	for i := range canvas {
+		canvas[i] = make([]canvasCell, cols)
+	}
+
+	now := time.Now()
+	for _, key := range layout.Keys {
+		// parseKLE keeps keys inside the layout, but a hand-made one might not
+		x0 := min(max(int(math.Round(key.X*float64(unit))), 0), cols-1)
+		x1 := min(max(int(math.Round((key.X+key.W)*float64(unit))), 0), cols-1)
+		y0 := min(max(int(math.Round(key.Y*2)), 0), rows-1)
+		y1 := min(max(int(math.Round((key.Y+key.H)*2)), 0), rows-1)
+		if x1 <= x0 || y1 <= y0 {
+			continue
+		}
+
+		for x := x0; x <= x1; x++ {
+			for _, y := range []int{y0, y1} {
+				if x > x0 {
+					canvas[y][x].lines |= lineLeft
+				}
+				if x < x1 {
+					canvas[y][x].lines |= lineRight
+				}
+			}
+		}
+		for y := y0; y <= y1; y++ {
+			for _, x := range []int{x0, x1} {
+				if y > y0 {
+					canvas[y][x].lines |= lineUp
+				}
+				if y < y1 {
+					canvas[y][x].lines |= lineDown
+				}
+			}
+		}
+
+		fill := ""
+		if light := KeyLight(key.Code, now); key.Mapped && light > 0 {
+			lit := sakuraRose
+			if modifierKeys[key.Code] {
+				lit = sakuraLove
+			}
+			fill = mixHex(sakuraBg, lit, light)
+			for y := y0 + 1; y < y1; y++ {
+				for x := x0 + 1; x < x1; x++ {
+					canvas[y][x].fill = fill
+				}
+			}
+		}
+
+		// Center the label in the key, cut down to fit
+		room := x1 - x0 - 1
+		label := segmentsText(truncateSegments([]Segment{{Text: keyLabel(key)}}, room))
+		x := x0 + 1 + (room-visibleWidth(label))/2
+		y := (y0 + y1) / 2
+		graphemes(label, func(cluster string, width int) bool {
+			canvas[y][x].text = cluster
+			for i := 1; i < width; i++ {
+				// Wide glyphs cover the cells after them
+				canvas[y][x+i].text = "\x00"
+			}
+			x += width
+			return true
+		})
+	}
+
+	lines := make([]string, rows)
+	for y, row := range canvas {
+		buf := strings.Builder{}
+		fill := ""
+		for _, cell := range row {
+			if cell.fill != fill {
+				if cell.fill == "" {
+					buf.WriteString("\x1b[0m")
+				} else if code := ansiColor(cell.fill, true); code != "" {
+					buf.WriteString("\x1b[0;" + code + ";" + ansiColor(textColor(cell.fill), false) + "m")
+				} else {
+					buf.WriteString("\x1b[0;7m")
+				}
+				fill = cell.fill
+			}
+
+			switch {
+			case cell.text == "\x00":
+			case cell.text != "":
+				buf.WriteString(cell.text)
+			case cell.lines != 0:
+				buf.WriteRune(boxGlyphs[cell.lines])
+			default:
+				buf.WriteByte(' ')
+			}
+		}
+		if fill != "" {
+			buf.WriteString("\x1b[0m")
+		}
+		lines[y] = buf.String()
+	}
+	return lines
+}
+
+func (r *KeyboardRenderer) Render(snap []Key) {
+	w, _, err := term.GetSize(0)
+	if err != nil || keyboard == nil {
+		return
+	}
+
+	unit := min(6, max(3, int(float64(w-1)/keyboard.W)))
+	lines := diagram(keyboard, unit)
+
+	st, l := fitChips(snap, w, " ", func(key Key) (string, int) {
+		chip := termChip(key, true, w-1)
+		return chip, visibleWidth(ansi.ReplaceAllString(chip, ""))
+	})
+	lines = append(lines, strings.Repeat(" ", max(0, w-l))+st)
+	r.draw(lines)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiagram(t *testing.T) {
+	layout, err := parseKLE([]byte(`[["A", "B"]]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"┌───┬───┐",
+		"│ A │ B │",
+		"└───┴───┘",
+	}
+	if got := diagram(layout, 4); !slices.Equal(got, want) {
+		t.Errorf("diagram:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiagramOutside(t *testing.T) {
+	// Layouts not from parseKLE can put keys anywhere
+	layout := &KeyboardLayout{
+		Keys: []KLEKey{
+			{X: -1, Y: -1, W: 2, H: 2, Legend: "A"},
+			{X: 1, Y: 0, W: 1, H: 1, Legend: "B"},
+			{X: 1.5, Y: 0.5, W: 3, H: 3, Legend: "C"},
+			{X: -5, Y: 0, W: 1, H: 1, Legend: "D"},
+		},
+		W: 2, H: 1,
+	}
+	lines := diagram(layout, 4)
+	if len(lines) != 3 {
+		t.Errorf("%d lines, want 3", len(lines))
+	}
+}
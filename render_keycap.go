@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	termKeycaps  bool
+	termRows     = 1
+	_flagKeycaps *bool
+	_flagRows    *uint
+)
+
+// keycapHeight is the number of lines a row of keycaps takes up
+const keycapHeight = 3
+
+// keycap draws the chip as a box like the QKey widget: key code and repeat
+// count in the top border, the label in the middle and the modifier bulbs
+// along the bottom, no wider than the width. Returns the lines along with
+// their visible width.
+func keycap(key Key, width int) ([keycapHeight]string, int) {
+	label, shifted := key.Label()
+	code := []Segment{}
+	switch {
+	case key.Action != "":
+		code = append(code, Segment{Text: key.Action, Color: &sakuraIris, Italic: true})
+	case key.Text:
+	case !key.Found && strings.HasPrefix(key.Name, "KEY_"):
+		code = append(code, Segment{Text: "key "}, Segment{Text: fmt.Sprint(key.Code), Bold: true})
+		label = []Segment{{Text: key.Name[len("KEY_"):], Color: &sakuraTree, Bold: true}}
+	case !key.Found && strings.HasPrefix(key.Name, "BTN_"):
+		code = append(code, Segment{Text: "btn "}, Segment{Text: fmt.Sprint(key.Code), Bold: true})
+		label = []Segment{{Text: key.Name[len("BTN_"):], Color: &sakuraTree, Bold: true}}
+	case !key.Found:
+		code = append(code, Segment{Text: fmt.Sprint(key.Code), Bold: true})
+		label = []Segment{{Text: key.Name, Color: &sakuraTree, Bold: true}}
+	default:
+		code = append(code, Segment{Text: fmt.Sprint(key.Code), Dim: true})
+	}
+
+	count := []Segment{}
+	if key.Count > 1 {
+		count = append(count, Segment{Text: fmt.Sprintf("x%d", key.Count), Color: &sakuraRose, Italic: true})
+	}
+
+	bulbs := []Segment{}
+	if key.Held.Shift && !shifted {
+		bulbs = append(bulbs, modSegment(modChar.Shift))
+	}
+	if key.Held.Meta {
+		bulbs = append(bulbs, modSegment(modChar.Meta))
+	}
+	if key.Held.Ctrl {
+		bulbs = append(bulbs, modSegment(modChar.Ctrl))
+	}
+	if key.Held.Alt {
+		bulbs = append(bulbs, modSegment(modChar.Alt))
+	}
+
+	// Slot templates replace what's in the slot, hidden rows leave the
+	// border bare
+	for slot, segs := range map[string]*[]Segment{"code": &code, "count": &count, "label": &label, "bulbs": &bulbs} {
+		if tmpl := slotTemplates[slot]; tmpl != nil && !key.Text {
+			*segs = []Segment{{Text: key.Expand(tmpl)}}
+		}
+	}
+	if hideHeader {
+		code, count = nil, nil
+	}
+	if hideFooter {
+		bulbs = nil
+	}
+
+	label = truncateSegments(label, width-4)
+	code = truncateSegments(code, width-3-visibleWidth(segmentsText(count)))
+
+	codeW := visibleWidth(segmentsText(code))
+	countW := visibleWidth(segmentsText(count))
+	labelW := visibleWidth(segmentsText(label))
+	bulbsW := visibleWidth(segmentsText(bulbs))
+	style := key.Style()
+	inner := max(labelW+2, codeW+countW+1, bulbsW+1, 3, min(width, int(style.Width*2))-2)
+
+	outline := chipBorder()
+	if style.Bg != nil {
+		outline = style.Bg
+	}
+	border := func(text string) Segment {
+		return Segment{Text: text, Color: outline}
+	}
+	left := (inner - labelW) / 2
+
+	top := append([]Segment{border("╭")}, code...)
+	top = append(top, border(strings.Repeat("─", inner-codeW-countW)))
+	top = append(append(top, count...), border("╮"))
+
+	mid := []Segment{border("│"), {Text: strings.Repeat(" ", left)}}
+	mid = append(append(mid, label...), Segment{Text: strings.Repeat(" ", inner-labelW-left)}, border("│"))
+
+	bot := append([]Segment{border("╰")}, bulbs...)
+	bot = append(bot, border(strings.Repeat("─", inner-bulbsW)+"╯"))
+
+	return [keycapHeight]string{
+		ansiSegments(top, nil),
+		ansiSegments(mid, nil),
+		ansiSegments(bot, nil),
+	}, inner + 2
+}
+
+// renderKeycaps lays out as many keycaps as fit in the width over up to
+// termRows rows, newest at the bottom right
+func (r *TermRenderer) renderKeycaps(snap []Key, w int) {
+	type row struct {
+		lines [keycapHeight]string
+		width int
+	}
+
+	now := time.Now()
+	rows := []row{{}}
+	for i := len(snap) - 1; i >= 0; i-- {
+		key := snap[i]
+		if key.Char == "\x00" {
+			continue
+		}
+
+		lines, n := keycap(key, w-1)
+		if key.Opacity(now) < 1 {
+			for j, line := range lines {
+				lines[j] = "\x1b[2m" + ansi.ReplaceAllString(line, "") + "\x1b[0m"
+			}
+		}
+
+		cur := &rows[len(rows)-1]
+		if cur.width > 0 && cur.width+1+n >= w {
+			if len(rows) >= termRows {
+				break
+			}
+			rows = append(rows, row{})
+			cur = &rows[len(rows)-1]
+		}
+		if n >= w {
+			break
+		}
+		for j, line := range lines {
+			if cur.width > 0 {
+				line += " "
+			}
+			cur.lines[j] = line + cur.lines[j]
+		}
+		if cur.width > 0 {
+			n++
+		}
+		cur.width += n
+	}
+
+	out := []string{}
+	for i := len(rows) - 1; i >= 0; i-- {
+		pad := strings.Repeat(" ", max(0, w-rows[i].width))
+		for _, line := range rows[i].lines {
+			out = append(out, pad+line)
+		}
+	}
+	r.draw(out)
+}
@@ -0,0 +1,21 @@
+//go:build noqt
+
+package main
+
+import (
+	"fmt"
+)
+
+type QtRenderer struct{}
+
+func NewQtRenderer() (*QtRenderer, error) {
+	return nil, fmt.Errorf("built without Qt support")
+}
+
+func (r *QtRenderer) Capacity() int {
+	return 0
+}
+
+func (r *QtRenderer) Render(snap []Key) {}
+
+func (r *QtRenderer) Run() {}
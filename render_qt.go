@@ -0,0 +1,767 @@
+//go:build !noqt
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mappu/miqt/qt6"
+	"github.com/mappu/miqt/qt6/mainthread"
+)
+
+var (
+	kblist   *qt6.QHBoxLayout
+	kblistMu *qt6.QHBoxLayout
+	label    *qt6.QLabel
+	labelMu  sync.Mutex
+	kb2      *qt6.QScrollArea
+	font     *qt6.QFont
+	win      *qt6.QWidget
+	app      *qt6.QApplication
+)
+
+type QtRenderer struct {
+	ready    atomic.Bool
+	capacity atomic.Int64
+
+	// Last known window geometry, saved on exit
+	geoMu   sync.Mutex
+	geo     Geometry
+	visible bool
+
+	// Only touched from the main thread
+	chips    map[uint64]*QKey
+	pool     []*QKey
+	shown    []uint64
+	settings *qt6.QDialog
+}
+
+func NewQtRenderer() (*QtRenderer, error) {
+	return &QtRenderer{chips: map[uint64]*QKey{}}, nil
+}
+
+func (r *QtRenderer) Capacity() int {
+	return int(r.capacity.Load())
+}
+
+func (r *QtRenderer) Render(snap []Key) {
+	if !r.ready.Load() {
+		return
+	}
+	mainthread.Start(func() {
+		r.render(snap)
+	})
+}
+
+func scaleLabel(_ *qt6.QSize) {
+	Redraw()
+}
+
+var boxDirections = map[Orientation]qt6.QBoxLayout__Direction{
+	RightToLeft: qt6.QBoxLayout__RightToLeft,
+	LeftToRight: qt6.QBoxLayout__LeftToRight,
+	TopToBottom: qt6.QBoxLayout__TopToBottom,
+	BottomToTop: qt6.QBoxLayout__BottomToTop,
+}
+
+type Sizes struct {
+	Max *uint
+	Min *uint
+	Fix *uint
+}
+
+func (r *QtRenderer) Run() {
+	app = qt6.NewQApplication(os.Args)
+	defer qt6.QApplication_Exec()
+
+	reducedMotion = reducedMotion || desktopReducesMotion()
+	win = qt6.NewQWidget(nil)
+	win.SetWindowTitle("KbViz")
+	ico := qt6.QIcon_FromTheme2("ktouch", qt6.QIcon_FromTheme("input-keyboard"))
+	win.SetWindowIcon(ico)
+	saved, hasSaved := loadGeometry()
+	if hasSaved {
+		win.SetFixedSize2(saved.W, saved.H)
+	} else {
+		if orientation.Vertical() {
+			win.SetFixedSize2(64, 480)
+		} else if keyboard != nil {
+			win.SetFixedSize2(640, 240)
+		} else {
+			win.SetFixedSize2(640, 40)
+		}
+	}
+
+	screen := findScreen(targetScreen)
+	if overlayMode {
+		applyOverlay()
+	}
+
+	if _flagFontFamily == nil || *_flagFontFamily == "" {
+		font = qt6.QFontDatabase_SystemFont(qt6.QFontDatabase__GeneralFont)
+	} else {
+		font = qt6.NewQFont2(*_flagFontFamily)
+	}
+
+	label = qt6.NewQLabel(nil)
+	label.SetMinimumSize2(1, 1)
+	label.SetAlignment(qt6.AlignRight)
+	label.SetFont(font)
+
+	// kblist = qt6.NewQHBoxLayout(nil)
+	// kblist.SetContentsMargins(4, 4, 4, 4)
+	// layout.SetDirection(qt6.QBoxLayout__RightToLeft)
+	// layout.AddWidget3(label.QWidget, 0, qt6.AlignRight)
+
+	win.SetLayoutDirection(qt6.RightToLeft)
+	win.SetContentsMargins(0, 0, 0, 0)
+	styleWindow()
+	/*
+		scrollarea = QScrollArea(parent.widget())
+		layout = QVBoxLayout(scrollarea)
+		realmScroll.setWidget(layout.widget())
+
+		layout.addWidget(QLabel("Test"))
+	*/
+
+	container := qt6.NewQWidget(nil)
+	kblist = qt6.NewQHBoxLayout(container)
+	kblist.SetDirection(boxDirections[orientation])
+	kblist.SetContentsMargins(0, 0, 0, 0)
+	kblist.SetSpacing(themeSpacing)
+
+	kb2 = qt6.NewQScrollArea(nil)
+	kb2.SetWidget(container)
+	kb2.SetWidgetResizable(true)
+	kb2.SetHorizontalScrollBarPolicy(qt6.ScrollBarAlwaysOff)
+	kb2.SetVerticalScrollBarPolicy(qt6.ScrollBarAlwaysOff)
+	if overlayMode {
+		kb2.SetFrameShape(qt6.QFrame__NoFrame)
+		kb2.Viewport().SetAutoFillBackground(false)
+		container.SetAutoFillBackground(false)
+		kb2.SetStyleSheet("background: transparent;")
+	}
+	kblist.AddStretch()
+
+	scroller := qt6.NewQVBoxLayout(win)
+	scroller.SetContentsMargins(0, 0, 0, 0)
+	if keyboard != nil {
+		// The keyboard gets most of the height, the strip the rest
+		kbview = newKeyboardView()
+		scroller.AddWidget2(kb2.QWidget, 1)
+		scroller.AddWidget2(kbview, 5)
+	} else {
+		scroller.AddWidget(kb2.QWidget)
+	}
+
+	win.OnResizeEvent(func(_ func(_ *qt6.QResizeEvent), evt *qt6.QResizeEvent) {
+		scaleLabel(evt.Size())
+		if windowAnchor != nil && r.isVisible() {
+			r.place(screen)
+		}
+		r.remember()
+	})
+
+	win.OnMoveEvent(func(_ func(_ *qt6.QMoveEvent), evt *qt6.QMoveEvent) {
+		r.remember()
+	})
+
+	scaleLabel(win.Size())
+
+	win.OnCloseEvent(func(_ func(_ *qt6.QCloseEvent), evt *qt6.QCloseEvent) {
+		r.Stop()
+		os.Exit(0)
+	})
+
+	win.OnShowEvent(func(_ func(event *qt6.QShowEvent), evt *qt6.QShowEvent) {
+		win.SetMaximumSize2(65535, 8192)
+		win.SetMinimumSize2(16, 16)
+
+		if windowAnchor != nil || targetScreen != "" {
+			r.place(screen)
+		} else if hasSaved {
+			win.Move(saved.X, saved.Y)
+		}
+		r.geoMu.Lock()
+		r.visible = true
+		r.geoMu.Unlock()
+		r.remember()
+
+		scaleLabel(win.Size())
+	})
+
+	win.OnKeyPressEvent(func(_ func(_ *qt6.QKeyEvent), evt *qt6.QKeyEvent) {
+		geo := win.Geometry()
+		step := 8
+		mods := evt.Modifiers()
+		if mods&qt6.ShiftModifier > 0 {
+			step = 32
+		} else if mods&qt6.ControlModifier > 0 {
+			step = 1
+		}
+
+		switch qt6.Key(evt.Key()) {
+		case qt6.Key_H, qt6.Key_Left:
+			win.SetGeometry(geo.X(), geo.Y(), max(16, geo.Width()-step), geo.Height())
+		case qt6.Key_J, qt6.Key_Down:
+			win.SetGeometry(geo.X(), geo.Y(), geo.Width(), min(8192, geo.Height()+step))
+		case qt6.Key_K, qt6.Key_Up:
+			win.SetGeometry(geo.X(), geo.Y(), geo.Width(), max(16, geo.Height()-step))
+		case qt6.Key_L, qt6.Key_Right:
+			win.SetGeometry(geo.X(), geo.Y(), min(8192, geo.Width()+step), geo.Height())
+		}
+	})
+
+	r.newTray(ico)
+
+	// Right-click or Ctrl+, for the settings
+	settings := qt6.NewQAction5("Settings…", win.QObject)
+	settings.SetShortcut(qt6.NewQKeySequence2("Ctrl+,"))
+	settings.OnTriggered(r.openSettings)
+	win.AddAction(settings)
+	win.SetContextMenuPolicy(qt6.ActionsContextMenu)
+
+	r.ready.Store(true)
+	win.Show()
+}
+
+// findScreen looks up the screen by index or name, falling back to the
+// primary screen
+func findScreen(want string) *qt6.QScreen {
+	if want == "" {
+		return qt6.QGuiApplication_PrimaryScreen()
+	}
+
+	screens := qt6.QGuiApplication_Screens()
+	if i, err := strconv.Atoi(want); err == nil && i >= 0 && i < len(screens) {
+		return screens[i]
+	}
+	for _, screen := range screens {
+		if screen.Name() == want {
+			return screen
+		}
+	}
+	fmt.Fprintf(os.Stderr, "gui: \x1b[91;1mscreen `%s' doesn't exist\x1b[0m\n", want)
+	return qt6.QGuiApplication_PrimaryScreen()
+}
+
+// place moves the window to its anchor on the screen, or the middle of it
+// when there's no anchor
+func (r *QtRenderer) place(screen *qt6.QScreen) {
+	anchor := Anchor{}
+	if windowAnchor != nil {
+		anchor = *windowAnchor
+	}
+	area := screen.AvailableGeometry()
+	x, y := anchor.Place(area.X(), area.Y(), area.Width(), area.Height(), win.Width(), win.Height())
+	if win.X() != x || win.Y() != y {
+		win.Move(x, y)
+	}
+}
+
+// applyOverlay sets the window flags for overlay mode and click-through.
+// Changing them hides the window, so it's shown again if it was showing.
+func applyOverlay() {
+	showing := win.IsVisible()
+	flags := qt6.Window
+	if overlayMode {
+		flags = qt6.FramelessWindowHint | qt6.WindowStaysOnTopHint | qt6.Tool
+		if clickThrough {
+			flags |= qt6.WindowTransparentForInput
+		}
+	}
+	win.SetWindowFlags(flags)
+	win.SetAttribute2(qt6.WA_TranslucentBackground, overlayMode)
+	win.SetAttribute2(qt6.WA_ShowWithoutActivating, overlayMode)
+	styleWindow()
+	if showing {
+		win.Show()
+	}
+}
+
+// styleWindow paints the window in the theme's color, except as an overlay
+func styleWindow() {
+	if themeWindow != "" && !overlayMode {
+		win.SetStyleSheet(fmt.Sprintf("background-color: %s;", themeWindow))
+	} else {
+		win.SetStyleSheet("")
+	}
+}
+
+func (r *QtRenderer) isVisible() bool {
+	r.geoMu.Lock()
+	defer r.geoMu.Unlock()
+	return r.visible
+}
+
+// remember notes the window geometry so it can be saved from any thread
+func (r *QtRenderer) remember() {
+	geo := win.Geometry()
+	r.geoMu.Lock()
+	defer r.geoMu.Unlock()
+	if r.visible {
+		r.geo = Geometry{geo.X(), geo.Y(), geo.Width(), geo.Height()}
+	}
+}
+
+func (r *QtRenderer) Start() error {
+	return nil
+}
+
+// Stop saves the window geometry for the next run
+func (r *QtRenderer) Stop() {
+	r.geoMu.Lock()
+	defer r.geoMu.Unlock()
+	if !r.visible {
+		return
+	}
+	if err := saveGeometry(r.geo); err != nil {
+		fmt.Fprintf(os.Stderr, "gui: \x1b[91;1m%s\x1b[0m\n", err.Error())
+	}
+}
+
+type QKey struct {
+	Widget *qt6.QWidget
+	Layout *qt6.QVBoxLayout
+
+	KeyName   *qt6.QLabel
+	KeyCode   *qt6.QLabel
+	RepCount  *qt6.QLabel
+	CtrlBulb  *qt6.QLabel
+	MetaBulb  *qt6.QLabel
+	AltBulb   *qt6.QLabel
+	ShiftBulb *qt6.QLabel
+	// Stands in for the bulbs with a bulbs template
+	FootText *qt6.QLabel
+
+	Opacity *qt6.QGraphicsOpacityEffect
+
+	HeadWidget *qt6.QWidget
+	HeadLayout *qt6.QHBoxLayout
+
+	FootWidget *qt6.QWidget
+	FootLayout *qt6.QHBoxLayout
+
+	Animations
+
+	// What the labels currently show, the chip's background and the one
+	// it's showing, which differ while it pulses
+	Key  Key
+	Base string
+	Bg   string
+}
+
+type Corner int
+
+const (
+	TopLeft Corner = 1 << iota
+	TopRight
+	BotLeft
+	BotRight
+
+	NoCorner Corner = 0
+)
+
+var cornerRadii = []struct {
+	Corner
+	Property string
+}{
+	{TopLeft, "border-top-left-radius"},
+	{TopRight, "border-top-right-radius"},
+	{BotLeft, "border-bottom-left-radius"},
+	{BotRight, "border-bottom-right-radius"},
+}
+
+// styleKeyPart styles one part of a chip from the theme, rounding the
+// corners it sits in
+func styleKeyPart(corner Corner, part string, bg string) string {
+	style := fmt.Sprintf("background-color: %s;", bg)
+	if themeFg != "" || bg != sakuraBg {
+		style += fmt.Sprintf(" color: %s;", textColor(bg))
+	}
+	if themeWeight != "" {
+		style += fmt.Sprintf(" font-weight: %s;", themeWeight)
+	}
+
+	for _, radius := range cornerRadii {
+		if corner&radius.Corner != 0 {
+			style += fmt.Sprintf(" %s: %dpx;", radius.Property, themeRadius)
+		}
+	}
+	if extra := partStyles[part]; extra != "" {
+		style += " " + extra
+	}
+	return style
+}
+
+// bold wraps rich text in the theme's bold weight
+func bold(text string) string {
+	return fmt.Sprintf("<span style='font-weight: %s'>%s</span>", themeBold, text)
+}
+
+// richSegments renders segments as rich text for the labels
+func richSegments(segs []Segment) string {
+	ret := ""
+	for _, seg := range segs {
+		text := html.EscapeString(seg.Text)
+		if seg.Bold {
+			text = bold(text)
+		}
+		if seg.Italic {
+			text = "<i>" + text + "</i>"
+		}
+		if seg.Color != nil {
+			text = fmt.Sprintf("<font color='%s'>%s</font>", *seg.Color, text)
+		}
+		ret += text
+	}
+	return ret
+}
+
+func newQKey() *QKey {
+	q := &QKey{}
+	gap := themeGap
+
+	/*
+		| key code    |    repeat count |
+		|-------------------------------|
+		|                               |
+		|      key name                 |
+		|                               |
+		|-------------------------------|
+		| shift  | meta  | ctrl  | alt  |
+	*/
+	q.Widget = qt6.NewQWidget(nil)
+	q.Layout = qt6.NewQVBoxLayout(q.Widget)
+	q.Layout.SetContentsMargins(themePadding, themePadding, themePadding, themePadding)
+	q.Widget.SetObjectName(*qt6.NewQAnyStringView3("chip"))
+	q.Widget.SetAttribute(qt6.WA_StyledBackground)
+	q.Opacity = qt6.NewQGraphicsOpacityEffect()
+	q.Widget.SetGraphicsEffect(q.Opacity.QGraphicsEffect)
+
+	q.KeyName = qt6.NewQLabel3(" ")
+	q.KeyCode = qt6.NewQLabel3(" ")
+	q.RepCount = qt6.NewQLabel3(" ")
+	q.CtrlBulb = qt6.NewQLabel3(" ")
+	q.AltBulb = qt6.NewQLabel3(" ")
+	q.MetaBulb = qt6.NewQLabel3(" ")
+	q.ShiftBulb = qt6.NewQLabel3(" ")
+	q.FootText = qt6.NewQLabel3(" ")
+
+	q.restyle(sakuraBg)
+
+	q.HeadWidget = qt6.NewQWidget(nil)
+	q.HeadLayout = qt6.NewQHBoxLayout(q.HeadWidget)
+	q.HeadLayout.SetContentsMargins(0, 0, 0, 0)
+	q.HeadLayout.SetSpacing(gap)
+	q.HeadLayout.AddWidget(q.RepCount.QWidget)
+	q.HeadLayout.AddWidget(q.KeyCode.QWidget)
+	q.RepCount.SetAlignment(qt6.AlignRight)
+
+	q.FootWidget = qt6.NewQWidget(nil)
+	q.FootLayout = qt6.NewQHBoxLayout(q.FootWidget)
+	q.FootLayout.SetContentsMargins(0, 0, 0, 0)
+	q.FootLayout.SetSpacing(gap)
+	q.ShiftBulb.SetAlignment(qt6.AlignCenter)
+	q.MetaBulb.SetAlignment(qt6.AlignCenter)
+	q.CtrlBulb.SetAlignment(qt6.AlignCenter)
+	q.AltBulb.SetAlignment(qt6.AlignCenter)
+	q.FootLayout.AddWidget(q.ShiftBulb.QWidget)
+	q.FootLayout.AddWidget(q.AltBulb.QWidget)
+	q.FootLayout.AddWidget(q.MetaBulb.QWidget)
+	q.FootLayout.AddWidget(q.CtrlBulb.QWidget)
+	q.FootLayout.AddWidget(q.FootText.QWidget)
+	q.FootText.SetAlignment(qt6.AlignCenter)
+	bulbs := slotTemplates["bulbs"] == nil
+	for _, bulb := range []*qt6.QLabel{q.ShiftBulb, q.AltBulb, q.MetaBulb, q.CtrlBulb} {
+		bulb.SetVisible(bulbs)
+	}
+	q.FootText.SetVisible(!bulbs)
+
+	q.Layout.SetSpacing(gap)
+	q.Layout.AddWidget(q.HeadWidget)
+	q.Layout.AddWidget2(q.KeyName.QWidget, 1)
+	q.Layout.AddWidget(q.FootWidget)
+	q.HeadWidget.SetVisible(!hideHeader)
+	q.FootWidget.SetVisible(!hideFooter)
+	q.KeyName.SetAlignment(qt6.AlignCenter)
+
+	q.animate()
+	return q
+}
+
+// restyle puts the chip on the background
+func (q *QKey) restyle(bg string) {
+	if q.Bg == bg {
+		return
+	}
+	q.Bg = bg
+	if themeBorderWidth > 0 && themeBorder != "" {
+		q.Widget.SetStyleSheet(fmt.Sprintf("#chip { border: %dpx solid %s; border-radius: %dpx; }",
+			themeBorderWidth, themeBorder, themeRadius+themePadding))
+	} else {
+		q.Widget.SetStyleSheet("")
+	}
+	// The label takes the corners of the rows that are hidden
+	name := NoCorner
+	if hideHeader {
+		name |= TopLeft | TopRight
+	}
+	if hideFooter {
+		name |= BotLeft | BotRight
+	}
+	q.KeyName.SetStyleSheet(styleKeyPart(name, "keyname", bg))
+	q.FootText.SetStyleSheet(styleKeyPart(BotLeft|BotRight, "bulbs", bg))
+	q.KeyCode.SetStyleSheet(styleKeyPart(TopLeft, "keycode", bg))
+	q.RepCount.SetStyleSheet(styleKeyPart(TopRight, "repcount", bg))
+	q.CtrlBulb.SetStyleSheet(styleKeyPart(BotLeft, "bulbs", bg))
+	q.AltBulb.SetStyleSheet(styleKeyPart(NoCorner, "bulbs", bg))
+	q.MetaBulb.SetStyleSheet(styleKeyPart(NoCorner, "bulbs", bg))
+	q.ShiftBulb.SetStyleSheet(styleKeyPart(BotRight, "bulbs", bg))
+}
+
+func (q *QKey) Reset() {
+	for _, label := range []*qt6.QLabel{
+		q.KeyName, q.KeyCode, q.RepCount, q.CtrlBulb, q.AltBulb, q.MetaBulb, q.ShiftBulb, q.FootText,
+	} {
+		label.SetText(" ")
+		label.SetTextFormat(qt6.AutoText)
+	}
+	q.Widget.SetToolTip("")
+	q.Opacity.SetOpacity(1)
+}
+
+func (q *QKey) Fill(key Key) {
+	q.Reset()
+	q.Key = key
+
+	if key.Count > 1 {
+		q.RepCount.SetText(fmt.Sprintf("x%d", key.Count))
+	}
+
+	sub := key.Char
+	r, sz := utf8.DecodeRuneInString(sub + ".")
+	skipShift := false
+	if key.Text {
+		q.KeyName.SetTextFormat(qt6.PlainText)
+		q.KeyName.SetText(key.Char)
+	} else if !key.Found {
+		if strings.HasPrefix(key.Name, "KEY_") {
+			q.KeyCode.SetText(fmt.Sprintf("key %s", bold(strconv.Itoa(int(key.Code)))))
+			q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name[len("KEY_"):]))
+		} else if strings.HasPrefix(key.Name, "BTN_") {
+			q.KeyCode.SetText(fmt.Sprintf("btn %s", bold(strconv.Itoa(int(key.Code)))))
+			q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name[len("BTN_"):]))
+		} else {
+			q.KeyCode.SetText(bold(strconv.Itoa(int(key.Code))))
+			q.KeyName.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraTree, key.Name))
+		}
+	} else if utf8.RuneCountInString(key.Char) > 1 && r < 255 {
+		q.KeyName.SetText(bold(sub))
+	} else if r == leftCharRune {
+		q.KeyName.SetText(
+			fmt.Sprintf("<font color='%s'>%s</font>", sakuraGold, leftChar) +
+				fmt.Sprintf("<font color='%s'>%s</font>", sakuraIris, bold(sub[sz:])),
+		)
+	} else if r > 255 {
+		r, sz = utf8.DecodeLastRuneInString(sub)
+		if r == rightCharRune {
+			q.KeyName.SetText(
+				fmt.Sprintf("<font color='%s'>%s</font>", sakuraIris, bold(sub[:len(sub)-sz])) +
+					fmt.Sprintf("<font color='%s'>%s</font>", sakuraGold, rightChar),
+			)
+		} else {
+			q.KeyName.SetText(
+				fmt.Sprintf("<font color='%s'>%s</font>", sakuraIris, bold(sub)),
+			)
+		}
+	} else if shift, exist := shifts[strings.ToLower(sub)]; key.Held.Shift && exist {
+		skipShift = true
+		q.KeyName.SetText(shift)
+	} else {
+		q.KeyName.SetText(strings.ToLower(sub))
+	}
+
+	style := key.Style()
+	if !key.Text && (style.Icon != "" || style.Color != nil) {
+		label, shifted := key.Label()
+		q.KeyName.SetTextFormat(qt6.RichText)
+		q.KeyName.SetText(richSegments(label))
+		skipShift = shifted
+	}
+	q.Base = sakuraBg
+	if style.Bg != nil {
+		q.Base = *style.Bg
+	}
+	if q.Pulse == nil || !running(q.Pulse.QAbstractAnimation) {
+		q.restyle(q.Base)
+	}
+
+	if key.Held.Shift && !skipShift {
+		q.ShiftBulb.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraLove, bold(modChar.Shift)))
+	}
+	if key.Held.Meta {
+		q.MetaBulb.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraLove, bold(modChar.Meta)))
+	}
+	if key.Held.Ctrl {
+		q.CtrlBulb.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraLove, bold(modChar.Ctrl)))
+	}
+	if key.Held.Alt {
+		q.AltBulb.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraLove, bold(modChar.Alt)))
+	}
+	if key.Action != "" {
+		q.KeyCode.SetText(fmt.Sprintf("<font color='%s'>%s</font>", sakuraIris, html.EscapeString(key.Action)))
+		q.Widget.SetToolTip(fmt.Sprintf("%s: %s", key.Mode, key.Action))
+	}
+
+	if !key.Text {
+		for slot, label := range map[string]*qt6.QLabel{
+			"code": q.KeyCode, "count": q.RepCount, "label": q.KeyName, "bulbs": q.FootText,
+		} {
+			if tmpl := slotTemplates[slot]; tmpl != nil {
+				label.SetTextFormat(qt6.PlainText)
+				label.SetText(key.Expand(tmpl))
+			}
+		}
+	}
+}
+
+func (r *QtRenderer) acquire() *QKey {
+	if n := len(r.pool); n > 0 {
+		q := r.pool[n-1]
+		r.pool = r.pool[:n-1]
+		return q
+	}
+	return newQKey()
+}
+
+// recycle detaches the widget tree from the strip so the next chip can
+// reuse it
+func (r *QtRenderer) recycle(q *QKey) {
+	q.settle()
+	kblist.RemoveWidget(q.Widget)
+	q.Widget.Hide()
+	r.pool = append(r.pool, q)
+}
+
+func (r *QtRenderer) render(snap []Key) {
+	labelMu.Lock()
+	defer labelMu.Unlock()
+
+	// The strip is sized across its axis and fills up along it
+	cross := kb2.Size().Height()
+	room := kb2.Size().Width()
+	if orientation.Vertical() {
+		cross, room = room, cross
+	}
+	sz := cross - 8
+
+	metrics := qt6.NewQFontMetrics(font)
+	altFont := qt6.NewQFont5(font)
+	smallFont := qt6.NewQFont5(font)
+	smallerFont := qt6.NewQFont5(font)
+	if sz < 32 {
+		font.SetPixelSize(sz / 4)
+		smallFont.SetPixelSize(sz / 4)
+	} else if sz < 64 {
+		font.SetPixelSize(sz / 3)
+		smallFont.SetPixelSize(sz / 6)
+	} else {
+		font.SetPixelSize(sz / 2)
+		smallFont.SetPixelSize(sz / 8)
+	}
+	smallerFont.SetPixelSize(smallFont.PixelSize() * 3 / 4)
+	r.capacity.Store(int64(room/max(1, sz) + 1))
+
+	now := time.Now()
+	shown := []uint64{}
+	used := 0
+	for i := len(snap) - 1; i >= 0 && used < room; i-- {
+		key := snap[i]
+		if key.Char == "\x00" {
+			continue
+		}
+
+		q, ok := r.chips[key.ID]
+		if !ok {
+			q = r.acquire()
+			r.chips[key.ID] = q
+		}
+		if !ok || q.Key != key {
+			if !ok || key.Count > q.Key.Count {
+				q.pressed(ok)
+			}
+			q.Fill(key)
+		}
+
+		widget := q.Widget
+		width := sz
+		if key.Text {
+			q.KeyName.SetFont(font)
+			width = max(sz, qt6.NewQFontMetrics(font).HorizontalAdvance(key.Char)+16)
+		} else if key.Found {
+			q.KeyName.SetFont(font)
+		} else {
+			bounds := metrics.BoundingRectWithText(q.KeyName.Text())
+			ratio := float64(bounds.Height()) / float64(bounds.Width())
+			height := ratio * float64(sz) * 4
+			altFont.SetPixelSize(int(height))
+			q.KeyName.SetFont(altFont)
+			width = sz * 2
+		}
+		if least := int(key.Style().Width * float64(sz)); least > width {
+			width = least
+		}
+		extent := width
+		if orientation.Vertical() {
+			width = min(width, cross)
+			extent = sz
+		}
+		q.resize(width, sz, !ok)
+		q.AltBulb.SetFont(smallFont)
+		q.CtrlBulb.SetFont(smallFont)
+		q.MetaBulb.SetFont(smallFont)
+		q.RepCount.SetFont(smallFont)
+		q.KeyCode.SetFont(smallFont)
+		q.FootText.SetFont(smallFont)
+		q.ShiftBulb.SetFont(smallerFont)
+		q.ShiftBulb.SetFixedHeight(smallFont.PixelSize() * 4 / 3)
+		q.Opacity.SetOpacity(key.Opacity(now))
+
+		if kblist.IndexOf(widget) != len(shown) {
+			kblist.RemoveWidget(widget)
+			kblist.InsertWidget(len(shown), widget)
+		}
+		widget.Show()
+		shown = append(shown, key.ID)
+		used += extent + kblist.Spacing()
+	}
+
+	// Chips that scrolled off or expired give their widgets back to the
+	// pool, those that expired without fading fade out first
+	for _, id := range r.shown {
+		if slices.Contains(shown, id) {
+			continue
+		}
+		q := r.chips[id]
+		delete(r.chips, id)
+		expired := !slices.ContainsFunc(snap, func(key Key) bool { return key.ID == id })
+		if !expired || !q.leave(func() { r.recycle(q) }) {
+			r.recycle(q)
+		}
+	}
+	r.shown = shown
+
+	if kbview != nil {
+		kbview.Update()
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	statusWidth    = 40
+	_flagWidth     *uint
+	statusEncoders = map[string]func([]Segment) string{
+		"waybar":  pangoSegments,
+		"i3bar":   pangoSegments,
+		"polybar": polybarSegments,
+		"tmux":    tmuxSegments,
+	}
+)
+
+func pangoSegments(segs []Segment) string {
+	ret := ""
+	for _, seg := range segs {
+		attrs := ""
+		if seg.Color != nil {
+			attrs += fmt.Sprintf(" foreground='%s'", *seg.Color)
+		}
+		if seg.Bold {
+			attrs += " weight='bold'"
+		}
+		if seg.Italic {
+			attrs += " style='italic'"
+		}
+		if seg.Dim {
+			attrs += " alpha='60%'"
+		}
+
+		if attrs == "" {
+			ret += html.EscapeString(seg.Text)
+		} else {
+			ret += fmt.Sprintf("<span%s>%s</span>", attrs, html.EscapeString(seg.Text))
+		}
+	}
+	return ret
+}
+
+func polybarSegments(segs []Segment) string {
+	ret := ""
+	for _, seg := range segs {
+		text := strings.ReplaceAll(seg.Text, "%", "%%")
+		if seg.Color != nil {
+			ret += fmt.Sprintf("%%{F%s}%s%%{F-}", *seg.Color, text)
+		} else {
+			ret += text
+		}
+	}
+	return ret
+}
+
+func tmuxSegments(segs []Segment) string {
+	ret := ""
+	for _, seg := range segs {
+		style := []string{}
+		if seg.Color != nil {
+			style = append(style, "fg="+*seg.Color)
+		}
+		if seg.Bold {
+			style = append(style, "bold")
+		}
+		if seg.Italic {
+			style = append(style, "italics")
+		}
+		if seg.Dim {
+			style = append(style, "dim")
+		}
+
+		text := strings.ReplaceAll(seg.Text, "#", "##")
+		if len(style) == 0 {
+			ret += text
+		} else {
+			ret += "#[" + strings.Join(style, ",") + "]" + text + "#[default]"
+		}
+	}
+	return ret
+}
+
+// StatusRenderer prints one line per change in a format status bars can
+// read from a long-running command
+type StatusRenderer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	format  string
+	encode  func([]Segment) string
+	last    string
+	started bool
+}
+
+func NewStatusRenderer(w io.Writer, format string) *StatusRenderer {
+	return &StatusRenderer{out: w, format: format, encode: statusEncoders[format]}
+}
+
+func (r *StatusRenderer) Capacity() int {
+	return statusWidth
+}
+
+func (r *StatusRenderer) Render(snap []Key) {
+	st, _ := fitChips(snap, statusWidth, " ", func(key Key) (string, int) {
+		segs := truncateSegments(key.Segments(true), statusWidth-1)
+		return r.encode(segs), visibleWidth(segmentsText(segs))
+	})
+
+	line := st
+	switch r.format {
+	case "waybar":
+		line = r.waybar(snap, st)
+	case "i3bar":
+		line = jsonLine([]map[string]string{{
+			"name":      "kbviz",
+			"full_text": st,
+			"markup":    "pango",
+		}}) + ","
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started && line == r.last {
+		return
+	}
+	if !r.started && r.format == "i3bar" {
+		fmt.Fprintln(r.out, `{"version":1}`)
+		fmt.Fprintln(r.out, "[")
+	}
+	r.started = true
+	r.last = line
+	fmt.Fprintln(r.out, line)
+}
+
+func (r *StatusRenderer) waybar(snap []Key, text string) string {
+	tooltip := []string{}
+	class := []string{}
+	for _, key := range snap {
+		if key.Char == "\x00" {
+			continue
+		}
+		tooltip = append(tooltip, fmt.Sprintf("%s %s", key.Name, segmentsText(key.Segments(true))))
+	}
+
+	if len(tooltip) == 0 {
+		class = append(class, "empty")
+	} else {
+		held := snap[len(snap)-1].Held
+		for _, mod := range []struct {
+			held bool
+			name string
+		}{
+			{held.Shift, "shift"},
+			{held.Ctrl, "ctrl"},
+			{held.Alt, "alt"},
+			{held.Meta, "meta"},
+		} {
+			if mod.held {
+				class = append(class, mod.name)
+			}
+		}
+	}
+
+	return jsonLine(map[string]any{
+		"text":    text,
+		"tooltip": html.EscapeString(strings.Join(tooltip, "\n")),
+		"class":   class,
+	})
+}
+
+func jsonLine(val any) string {
+	buf := strings.Builder{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(val)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStatusSegments(t *testing.T) {
+	red := "#ff0000"
+	segs := []Segment{{Text: "50%"}, {Text: "#1 <b>", Color: &red, Bold: true}}
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{"polybar", "50%%%{F#ff0000}#1 <b>%{F-}"},
+		{"tmux", "50%#[fg=#ff0000,bold]##1 <b>#[default]"},
+		{"waybar", "50%<span foreground='#ff0000' weight='bold'>#1 &lt;b&gt;</span>"},
+	} {
+		if got := statusEncoders[tt.format](segs); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
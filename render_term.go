@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+var ansi = regexp.MustCompile("\x1b\\[\\d+(;\\d+)*m")
+
+// ansiSegments renders the segments with SGR escapes. With a background,
+// the chip is padded and every segment restates it, since resetting the
+// style would drop it.
+func ansiSegments(segs []Segment, bg *string) string {
+	base := ""
+	fg := ""
+	if bg != nil {
+		base = ansiColor(*bg, true)
+		fg = textColor(*bg)
+	}
+
+	ret := ""
+	if base != "" {
+		ret += "\x1b[0;" + base + "m "
+	}
+	for _, seg := range segs {
+		codes := []string{}
+		if base != "" {
+			codes = append(codes, "0", base)
+		}
+		if seg.Dim {
+			codes = append(codes, "2")
+		}
+		color := fg
+		if seg.Color != nil {
+			color = *seg.Color
+		}
+		if color != "" {
+			if code := ansiColor(color, false); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		if seg.Bold {
+			codes = append(codes, "1")
+		}
+		if seg.Italic {
+			codes = append(codes, "3")
+		}
+
+		if len(codes) == 0 {
+			ret += seg.Text
+		} else if base != "" {
+			ret += "\x1b[" + strings.Join(codes, ";") + "m" + seg.Text
+		} else {
+			ret += "\x1b[" + strings.Join(codes, ";") + "m" + seg.Text + "\x1b[0m"
+		}
+	}
+	if base != "" {
+		ret += " \x1b[0m"
+	}
+	return ret
+}
+
+func (key Key) String(withCount bool) string {
+	return termChip(key, withCount, math.MaxInt)
+}
+
+// termChip renders the chip for the terminal, or the -template for it, cut
+// down to the width and padded out to the width its style asks for
+func termChip(key Key, withCount bool, width int) string {
+	segs := key.Segments(withCount)
+	if termTemplate != nil && !key.Text {
+		segs = []Segment{{Text: key.Expand(termTemplate)}}
+	}
+	style := key.Style()
+	bg := style.Bg
+	if bg == nil && termChipBg {
+		bg = &sakuraBg
+	}
+	if bg != nil {
+		width -= 2
+	}
+
+	segs = truncateSegments(segs, width)
+	if pad := min(width, int(style.Width*2)) - visibleWidth(segmentsText(segs)); pad > 0 {
+		segs = append([]Segment{{Text: strings.Repeat(" ", pad/2)}}, segs...)
+		segs = append(segs, Segment{Text: strings.Repeat(" ", pad-pad/2)})
+	}
+	return ansiSegments(segs, bg)
+}
+
+var (
+	termAltScreen  bool
+	_flagAltScreen *bool
+)
+
+// TermRenderer draws the strip in place below the cursor, or on the
+// alternate screen, without touching the rest of the terminal
+type TermRenderer struct {
+	mu       sync.Mutex
+	started  bool
+	reserved int
+	saved    *unix.Termios
+	graphics GraphicsMode
+	keycaps  map[keycapState]*keycapCache
+	// lastImage numbers the kitty images sent so far, guarded by mu
+	lastImage int
+}
+
+func (r *TermRenderer) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !term.IsTerminal(0) {
+		return nil
+	}
+
+	saved, err := quietTerm()
+	if err != nil {
+		return err
+	}
+	r.saved = saved
+
+	r.graphics = graphicsMode
+	if r.graphics == GraphicsAuto {
+		r.graphics = detectGraphics()
+	}
+
+	if termAltScreen {
+		fmt.Print("\x1b[?1049h\x1b[H")
+	}
+	fmt.Print("\x1b[?25l\r\x1b7")
+	r.reserved = 1
+	r.started = true
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			Redraw()
+		}
+	}()
+	return nil
+}
+
+// quietTerm turns off echo and line buffering, returning the settings to
+// restore on exit. Keys are read straight from evdev, so the terminal
+// shouldn't echo them into our output.
+func quietTerm() (*unix.Termios, error) {
+	saved, err := unix.IoctlGetTermios(0, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	quiet := *saved
+	quiet.Lflag &^= unix.ECHO | unix.ICANON
+	if err := unix.IoctlSetTermios(0, unix.TCSETS, &quiet); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (r *TermRenderer) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		return
+	}
+	r.started = false
+
+	if r.graphics == GraphicsKitty {
+		for _, c := range r.keycaps {
+			fmt.Print(kittyDelete(c.id))
+		}
+	}
+	fmt.Print("\x1b8\x1b[J\x1b[?25h")
+	if termAltScreen {
+		fmt.Print("\x1b[?1049l")
+	}
+	if r.saved != nil {
+		unix.IoctlSetTermios(0, unix.TCSETS, r.saved)
+	}
+}
+
+// draw replaces our lines with new ones, growing the reserved area first
+// if needed
+func (r *TermRenderer) draw(lines []string) {
+	r.drawOverlay(lines, "")
+}
+
+// drawOverlay is draw followed by escapes that paint over the lines, such
+// as images
+func (r *TermRenderer) drawOverlay(lines []string, overlay string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		return
+	}
+
+	buf := strings.Builder{}
+	buf.WriteString("\x1b8")
+	if n := len(lines); n > r.reserved {
+		buf.WriteString(strings.Repeat("\n", n-1))
+		if n > 1 {
+			fmt.Fprintf(&buf, "\x1b[%dA", n-1)
+		}
+		buf.WriteString("\r\x1b7")
+		r.reserved = n
+	}
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("\x1b[2K")
+		buf.WriteString(line)
+	}
+	buf.WriteString("\x1b[J")
+	buf.WriteString(overlay)
+	os.Stdout.WriteString(buf.String())
+}
+
+func (r *TermRenderer) Capacity() int {
+	w, _, err := term.GetSize(0)
+	if err != nil {
+		return 0
+	}
+	if r.graphics != GraphicsNone {
+		return w / 4
+	}
+	if orientation.Vertical() && !termKeycaps {
+		return r.verticalRows()
+	}
+	if termKeycaps {
+		// The narrowest keycap is five columns plus a gap
+		return termRows * w / 6
+	}
+	return w / 2
+}
+
+func (r *TermRenderer) Render(snap []Key) {
+	w, _, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+
+	if r.graphics != GraphicsNone {
+		r.renderImages(snap, w)
+		return
+	}
+	if termKeycaps {
+		r.renderKeycaps(snap, w)
+		return
+	}
+
+	now := time.Now()
+	format := func(key Key) (string, int) {
+		chip := termChip(key, true, w-1)
+		plain := ansi.ReplaceAllString(chip, "")
+		if key.Opacity(now) < 1 {
+			chip = "\x1b[2m" + plain + "\x1b[0m"
+		}
+		return chip, visibleWidth(plain)
+	}
+
+	switch orientation {
+	case LeftToRight:
+		chips, _ := fitChipList(snap, w, 1, format)
+		r.draw([]string{strings.Join(chips, " ")})
+	case TopToBottom, BottomToTop:
+		// One chip per line, right aligned into a column
+		lines := []string{}
+		for i := len(snap) - 1; i >= 0 && len(lines) < r.verticalRows(); i-- {
+			if snap[i].Char == "\x00" {
+				continue
+			}
+			chip, n := format(snap[i])
+			lines = append(lines, strings.Repeat(" ", max(0, w-1-n))+chip)
+		}
+		if orientation == BottomToTop {
+			slices.Reverse(lines)
+		}
+		r.draw(lines)
+	default:
+		st, l := fitChips(snap, w, " ", format)
+		r.draw([]string{strings.Repeat(" ", max(0, w-l)) + st})
+	}
+}
+
+// verticalRows is how many lines a vertical strip takes up: the whole
+// alternate screen, or half the terminal when drawing inline
+func (r *TermRenderer) verticalRows() int {
+	_, h, err := term.GetSize(0)
+	if err != nil {
+		return 1
+	}
+	if termAltScreen {
+		return max(1, h-1)
+	}
+	return max(1, h/2)
+}
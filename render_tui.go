@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/holoplot/go-evdev"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// tuiLogSize is how many events the history pane keeps
+const tuiLogSize = 10000
+
+// TUIRenderer takes over the whole terminal: the live strip along the top
+// and a scrollable log of every key beneath it
+type TUIRenderer struct {
+	mu      sync.Mutex
+	started bool
+	saved   *unix.Termios
+
+	log *Ring[Key]
+	// Keys held back while paused, only as many as the log would keep
+	pending *Ring[Key]
+	strip   []Key
+	paused  bool
+
+	// Lines scrolled up from the newest entry
+	scroll    int
+	search    string
+	searching bool
+	query     string
+	held      ModSet[bool]
+	device    string
+}
+
+func NewTUIRenderer() *TUIRenderer {
+	return &TUIRenderer{log: NewRing[Key](tuiLogSize), pending: NewRing[Key](tuiLogSize)}
+}
+
+func (r *TUIRenderer) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !term.IsTerminal(0) {
+		return fmt.Errorf("the tui needs a terminal")
+	}
+	saved, err := quietTerm()
+	if err != nil {
+		return err
+	}
+	r.saved = saved
+	r.started = true
+	// Lines that don't fit are cut off instead of wrapping
+	fmt.Print("\x1b[?1049h\x1b[?25l\x1b[?7l")
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			Redraw()
+		}
+	}()
+	go r.input()
+	return nil
+}
+
+func (r *TUIRenderer) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		return
+	}
+	r.started = false
+	fmt.Print("\x1b[?7h\x1b[?25h\x1b[?1049l")
+	if r.saved != nil {
+		unix.IoctlSetTermios(0, unix.TCSETS, r.saved)
+	}
+}
+
+func (r *TUIRenderer) Chip(chip Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.paused {
+		r.pending.Push(chip)
+		return
+	}
+	r.log.Push(chip)
+	if r.scroll > 0 && r.matches(chip) {
+		// Keep the view still while scrolled back
+		r.scroll++
+	}
+}
+
+func (r *TUIRenderer) Capacity() int {
+	w, _, err := term.GetSize(0)
+	if err != nil {
+		return 0
+	}
+	return w / 2
+}
+
+// matches reports whether the entry passes the search and filters. Must be
+// called with mu held.
+func (r *TUIRenderer) matches(key Key) bool {
+	switch {
+	case r.held.Shift && !key.Held.Shift, r.held.Ctrl && !key.Held.Ctrl,
+		r.held.Alt && !key.Held.Alt, r.held.Meta && !key.Held.Meta:
+		return false
+	case r.device != "" && key.Device != r.device:
+		return false
+	case r.search != "":
+		line := strings.ToLower(ansi.ReplaceAllString(tuiLine(key), ""))
+		return strings.Contains(line, strings.ToLower(r.search))
+	}
+	return true
+}
+
+func tuiLine(key Key) string {
+	device := key.Device
+	if device == "" {
+		device = "-"
+	}
+	return fmt.Sprintf("\x1b[2m%s\x1b[0m  %-24.24s  %-6s %5d %-20.20s  %s",
+		key.Time.Format("15:04:05.000"),
+		device,
+		evdev.EVToString[key.Type],
+		key.Code,
+		key.Name,
+		termChip(key, false, 40),
+	)
+}
+
+func (r *TUIRenderer) Render(snap []Key) {
+	w, h, err := term.GetSize(0)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	if !r.started {
+		r.mu.Unlock()
+		return
+	}
+	if r.paused {
+		snap = r.strip
+	} else {
+		r.strip = snap
+	}
+
+	st, l := fitChips(snap, w, " ", func(key Key) (string, int) {
+		chip := termChip(key, true, w-1)
+		return chip, visibleWidth(ansi.ReplaceAllString(chip, ""))
+	})
+	lines := []string{
+		strings.Repeat(" ", max(0, w-l)) + st,
+		"\x1b[2m" + strings.Repeat("─", w) + "\x1b[0m",
+	}
+
+	shown := []Key{}
+	for i := 0; i < r.log.Len(); i++ {
+		if key := r.log.At(i); r.matches(key) {
+			shown = append(shown, key)
+		}
+	}
+	rows := max(0, h-len(lines)-1)
+	r.scroll = min(r.scroll, max(0, len(shown)-rows))
+	end := len(shown) - r.scroll
+	for i := max(0, end-rows); i < end; i++ {
+		lines = append(lines, tuiLine(shown[i]))
+	}
+	for len(lines) < h-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, r.status(len(shown)))
+	r.mu.Unlock()
+
+	buf := strings.Builder{}
+	buf.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("\x1b[2K")
+		buf.WriteString(line)
+	}
+	os.Stdout.WriteString(buf.String())
+}
+
+// status is the bottom line with the active filters and key hints. Must be
+// called with mu held.
+func (r *TUIRenderer) status(shown int) string {
+	if r.searching {
+		return "/" + r.query + "\x1b[7m \x1b[0m"
+	}
+
+	parts := []string{fmt.Sprintf("%d/%d", shown, r.log.Len())}
+	if r.paused {
+		parts = append(parts, fmt.Sprintf("\x1b[1mpaused\x1b[0m (+%d)", r.pending.Len()))
+	}
+	if r.search != "" {
+		parts = append(parts, "search: "+r.search)
+	}
+	mods := ""
+	for _, mod := range []struct {
+		held bool
+		char string
+	}{{r.held.Meta, modChar.Meta}, {r.held.Ctrl, modChar.Ctrl}, {r.held.Alt, modChar.Alt}, {r.held.Shift, modChar.Shift}} {
+		if mod.held {
+			mods += mod.char
+		}
+	}
+	if mods != "" {
+		parts = append(parts, "held: "+mods)
+	}
+	if r.device != "" {
+		parts = append(parts, "device: "+r.device)
+	}
+	parts = append(parts, "\x1b[2mj/k scroll  / search  c/a/s/m mods  d device  p pause  esc clear  q quit\x1b[0m")
+	return strings.Join(parts, "  ")
+}
+
+// input reads keys typed into the terminal until it's stopped
+func (r *TUIRenderer) input() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		quit := r.handle(string(buf[:n]))
+		r.mu.Unlock()
+		if quit {
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+			return
+		}
+		Redraw()
+	}
+}
+
+// handle applies one read's worth of input, returning whether to quit.
+// Must be called with mu held.
+func (r *TUIRenderer) handle(in string) bool {
+	if r.searching {
+		switch in {
+		case "\r", "\n":
+			r.search = r.query
+			r.searching = false
+			r.scroll = 0
+		case "\x1b":
+			r.searching = false
+		case "\x7f", "\b":
+			_, sz := utf8.DecodeLastRuneInString(r.query)
+			r.query = r.query[:len(r.query)-sz]
+		default:
+			if !strings.HasPrefix(in, "\x1b") {
+				r.query += in
+			}
+		}
+		return false
+	}
+
+	_, h, _ := term.GetSize(0)
+	page := max(1, h-3)
+	switch in {
+	case "q":
+		return true
+	case "j", "\x1b[B":
+		r.scroll = max(0, r.scroll-1)
+	case "k", "\x1b[A":
+		r.scroll++
+	case "\x1b[6~", " ":
+		r.scroll = max(0, r.scroll-page)
+	case "\x1b[5~":
+		r.scroll += page
+	case "g", "\x1b[H":
+		r.scroll = r.log.Len()
+	case "G", "\x1b[F":
+		r.scroll = 0
+	case "/":
+		r.searching = true
+		r.query = r.search
+	case "c":
+		r.held.Ctrl = !r.held.Ctrl
+	case "a":
+		r.held.Alt = !r.held.Alt
+	case "s":
+		r.held.Shift = !r.held.Shift
+	case "m":
+		r.held.Meta = !r.held.Meta
+	case "d":
+		r.device = r.nextDevice()
+	case "p":
+		r.paused = !r.paused
+		if !r.paused {
+			for i := 0; i < r.pending.Len(); i++ {
+				r.log.Push(r.pending.At(i))
+			}
+			r.pending.Clear()
+		}
+	case "\x1b":
+		r.search = ""
+		r.held = ModSet[bool]{}
+		r.device = ""
+		r.scroll = 0
+	}
+	return false
+}
+
+// nextDevice cycles the device filter through every device in the log,
+// then back to all of them. Must be called with mu held.
+func (r *TUIRenderer) nextDevice() string {
+	devices := []string{}
+	for i := 0; i < r.log.Len(); i++ {
+		if dev := r.log.At(i).Device; dev != "" && !slices.Contains(devices, dev) {
+			devices = append(devices, dev)
+		}
+	}
+	slices.Sort(devices)
+	i := slices.Index(devices, r.device)
+	if i+1 >= len(devices) {
+		return ""
+	}
+	return devices[i+1]
+}
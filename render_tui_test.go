@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTUIPause(t *testing.T) {
+	r := NewTUIRenderer()
+	r.Chip(Key{ID: 1})
+	r.handle("p")
+	for i := range tuiLogSize + 5 {
+		r.Chip(Key{ID: uint64(i + 2)})
+	}
+	if r.log.Len() != 1 {
+		t.Errorf("%d keys logged while paused, want 1", r.log.Len())
+	}
+	if r.pending.Len() != tuiLogSize {
+		t.Errorf("%d keys held back, want %d", r.pending.Len(), tuiLogSize)
+	}
+
+	r.handle("p")
+	if r.pending.Len() != 0 {
+		t.Errorf("%d keys still held back", r.pending.Len())
+	}
+	if r.log.Len() != tuiLogSize {
+		t.Errorf("%d keys logged, want %d", r.log.Len(), tuiLogSize)
+	}
+	if first, last := r.log.At(0).ID, r.log.At(r.log.Len()-1).ID; first != 7 || last != tuiLogSize+6 {
+		t.Errorf("log runs from %d to %d, want 7 to %d", first, last, tuiLogSize+6)
+	}
+}
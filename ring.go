@@ -0,0 +1,101 @@
+package main
+
+// Ring is a fixed capacity buffer that drops its oldest item once full.
+// Index 0 is always the oldest item.
+type Ring[T any] struct {
+	buf  []T
+	head int
+	size int
+}
+
+func NewRing[T any](capacity int) *Ring[T] {
+	return &Ring[T]{buf: make([]T, max(1, capacity))}
+}
+
+func (r *Ring[T]) Len() int {
+	return r.size
+}
+
+func (r *Ring[T]) Cap() int {
+	return len(r.buf)
+}
+
+func (r *Ring[T]) idx(i int) int {
+	return (r.head + i) % len(r.buf)
+}
+
+func (r *Ring[T]) At(i int) T {
+	if i < 0 || i >= r.size {
+		panic("ring: index out of range")
+	}
+	return r.buf[r.idx(i)]
+}
+
+func (r *Ring[T]) Last() (T, bool) {
+	if r.size == 0 {
+		var zero T
+		return zero, false
+	}
+	return r.At(r.size - 1), true
+}
+
+// Push appends an item, returning the evicted item if the ring was full
+func (r *Ring[T]) Push(item T) (T, bool) {
+	var evicted T
+	full := r.size == len(r.buf)
+	if full {
+		evicted = r.buf[r.head]
+		r.buf[r.head] = item
+		r.head = r.idx(1)
+	} else {
+		r.buf[r.idx(r.size)] = item
+		r.size++
+	}
+	return evicted, full
+}
+
+func (r *Ring[T]) Remove(i int) T {
+	ret := r.At(i)
+	var zero T
+	if i == 0 {
+		r.buf[r.head] = zero
+		r.head = r.idx(1)
+		r.size--
+		return ret
+	}
+
+	for ; i < r.size-1; i++ {
+		r.buf[r.idx(i)] = r.buf[r.idx(i+1)]
+	}
+	r.buf[r.idx(r.size-1)] = zero
+	r.size--
+	return ret
+}
+
+// Filter removes every item that keep() rejects and returns them in order
+func (r *Ring[T]) Filter(keep func(T) bool) []T {
+	removed := []T{}
+	n := 0
+	for i := range r.size {
+		item := r.At(i)
+		if keep(item) {
+			r.buf[r.idx(n)] = item
+			n++
+		} else {
+			removed = append(removed, item)
+		}
+	}
+
+	var zero T
+	for i := n; i < r.size; i++ {
+		r.buf[r.idx(i)] = zero
+	}
+	r.size = n
+	return removed
+}
+
+func (r *Ring[T]) Clear() {
+	clear(r.buf)
+	r.head = 0
+	r.size = 0
+}
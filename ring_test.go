@@ -0,0 +1,142 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func ringItems[T any](r *Ring[T]) []T {
+	items := []T{}
+	for i := range r.Len() {
+		items = append(items, r.At(i))
+	}
+	return items
+}
+
+func TestRingPush(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		cap     int
+		push    []int
+		want    []int
+		evicted []int
+	}{
+		{"empty", 3, nil, []int{}, nil},
+		{"partial", 3, []int{1, 2}, []int{1, 2}, nil},
+		{"full", 3, []int{1, 2, 3}, []int{1, 2, 3}, nil},
+		{"wraps", 3, []int{1, 2, 3, 4, 5}, []int{3, 4, 5}, []int{1, 2}},
+		{"wraps twice", 3, []int{1, 2, 3, 4, 5, 6, 7}, []int{5, 6, 7}, []int{1, 2, 3, 4}},
+		{"zero capacity holds one", 0, []int{1, 2}, []int{2}, []int{1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing[int](tt.cap)
+			var evicted []int
+			for _, item := range tt.push {
+				if old, full := r.Push(item); full {
+					evicted = append(evicted, old)
+				}
+			}
+			if got := ringItems(r); !slices.Equal(got, tt.want) {
+				t.Errorf("items %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(evicted, tt.evicted) {
+				t.Errorf("evicted %v, want %v", evicted, tt.evicted)
+			}
+			last, ok := r.Last()
+			if ok != (len(tt.want) > 0) || ok && last != tt.want[len(tt.want)-1] {
+				t.Errorf("last %v %v, want the newest of %v", last, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingRemove(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		push   []int
+		remove int
+		want   []int
+	}{
+		{"oldest", []int{1, 2, 3, 4}, 0, []int{2, 3, 4}},
+		{"middle", []int{1, 2, 3, 4}, 1, []int{1, 3, 4}},
+		{"newest", []int{1, 2, 3, 4}, 3, []int{1, 2, 3}},
+		{"oldest after wrapping", []int{1, 2, 3, 4, 5, 6}, 0, []int{4, 5, 6}},
+		{"middle after wrapping", []int{1, 2, 3, 4, 5, 6}, 1, []int{3, 5, 6}},
+		{"across the seam", []int{1, 2, 3, 4, 5}, 2, []int{2, 3, 5}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing[int](4)
+			for _, item := range tt.push {
+				r.Push(item)
+			}
+			want := r.At(tt.remove)
+			if got := r.Remove(tt.remove); got != want {
+				t.Errorf("removed %d, want %d", got, want)
+			}
+			if got := ringItems(r); !slices.Equal(got, tt.want) {
+				t.Errorf("items %v, want %v", got, tt.want)
+			}
+
+			// The freed slot takes the next push
+			r.Push(9)
+			if got := ringItems(r); !slices.Equal(got, append(tt.want, 9)) {
+				t.Errorf("after push %v, want %v", got, append(tt.want, 9))
+			}
+		})
+	}
+}
+
+func TestRingFilter(t *testing.T) {
+	even := func(i int) bool { return i%2 == 0 }
+	for _, tt := range []struct {
+		name    string
+		push    []int
+		keep    func(int) bool
+		want    []int
+		removed []int
+	}{
+		{"keeps all", []int{2, 4}, even, []int{2, 4}, []int{}},
+		{"drops all", []int{1, 3}, even, []int{}, []int{1, 3}},
+		{"mixed", []int{1, 2, 3, 4}, even, []int{2, 4}, []int{1, 3}},
+		{"after wrapping", []int{1, 2, 3, 4, 5, 6, 7}, even, []int{4, 6}, []int{5, 7}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing[int](4)
+			for _, item := range tt.push {
+				r.Push(item)
+			}
+			removed := r.Filter(tt.keep)
+			if got := ringItems(r); !slices.Equal(got, tt.want) {
+				t.Errorf("items %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(removed, tt.removed) {
+				t.Errorf("removed %v, want %v", removed, tt.removed)
+			}
+
+			for i := 10; i < 14; i++ {
+				r.Push(i)
+			}
+			if got := ringItems(r); !slices.Equal(got, []int{10, 11, 12, 13}) {
+				t.Errorf("refilled %v, want [10 11 12 13]", got)
+			}
+		})
+	}
+}
+
+func TestRingClear(t *testing.T) {
+	r := NewRing[int](3)
+	for i := range 5 {
+		r.Push(i)
+	}
+	r.Clear()
+	if r.Len() != 0 {
+		t.Errorf("len %d after clear", r.Len())
+	}
+	if _, ok := r.Last(); ok {
+		t.Error("last item after clear")
+	}
+	r.Push(7)
+	if got := ringItems(r); !slices.Equal(got, []int{7}) {
+		t.Errorf("items %v, want [7]", got)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+)
+
+var (
+	maxFPS   = 60
+	_flagFPS *uint
+	redrawCh = make(chan struct{}, 1)
+)
+
+// Redraw asks for a new frame. Calls made before the frame is drawn are
+// coalesced into one.
+func Redraw() {
+	select {
+	case redrawCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextFrame returns when the history next needs to be looked at without any
+// new input: every frame while a chip is fading, otherwise when the next
+// fade starts. Zero means nothing is pending. Must be called with historyMu
+// held.
+func nextFrame(now time.Time, frame time.Duration) time.Time {
+	var next time.Time
+	for i := range history.Len() {
+		key := history.At(i)
+		if key.TTL() <= 0 {
+			continue
+		}
+
+		at := key.Expiry().Add(-min(key.Fade(), key.TTL()))
+		if !at.After(now) {
+			at = now.Add(frame)
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+func schedule() {
+	frame := time.Second / time.Duration(max(1, maxFPS))
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	var last time.Time
+	for {
+		dirty := false
+		select {
+		case <-redrawCh:
+			dirty = true
+		case <-timer.C:
+		}
+
+		if wait := frame - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+			select {
+			case <-redrawCh:
+				dirty = true
+			default:
+			}
+		}
+
+		now := time.Now()
+		themeMu.RLock()
+		historyMu.Lock()
+		dirty = expireHistory(now) || dirty
+		next := nextFrame(now, frame)
+		historyMu.Unlock()
+		if keyboardFading(now) {
+			dirty = true
+			next = now.Add(frame)
+		}
+
+		if dirty {
+			PrintHistory()
+			last = now
+		}
+		themeMu.RUnlock()
+
+		if next.IsZero() {
+			timer.Stop()
+		} else {
+			timer.Reset(next.Sub(now))
+		}
+	}
+}
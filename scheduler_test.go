@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// nopRenderer takes every frame and draws nothing, counting the frames
+type nopRenderer struct {
+	frames atomic.Int64
+}
+
+func (r *nopRenderer) Capacity() int { return 0 }
+
+func (r *nopRenderer) Render(snap []Key) {
+	r.frames.Add(1)
+}
+
+// Presses in a typing-like pattern: runs of letters, repeats, and the
+// mouse moving in between
+func replayKeys(n int) []Key {
+	codes := []evdev.EvCode{evdev.KEY_H, evdev.KEY_E, evdev.KEY_L, evdev.KEY_L, evdev.KEY_O, evdev.KEY_SPACE}
+	keys := make([]Key, n)
+	for i := range keys {
+		switch {
+		case i%50 == 49:
+			keys[i] = Key{Type: evdev.EV_REL, Code: evdev.REL_X, Name: "REL_X"}
+		case i%200 >= 180:
+			keys[i] = Key{Type: evdev.EV_KEY, Code: evdev.KEY_BACKSPACE, Name: "KEY_BACKSPACE", Repeat: true}
+		default:
+			code := codes[i%len(codes)]
+			keys[i] = Key{Type: evdev.EV_KEY, Code: code, Name: evdev.CodeName(evdev.EV_KEY, code)}
+		}
+		keys[i].Char, keys[i].Found = tokens[keys[i].Type][keys[i].Code]
+		keys[i].Count = 1
+	}
+	return keys
+}
+
+var startScheduler sync.Once
+
+func BenchmarkReplay(b *testing.B) {
+	oldHistory := history
+	b.Cleanup(func() {
+		historyMu.Lock()
+		history = oldHistory
+		historyMu.Unlock()
+	})
+
+	// The scheduler can't be stopped, so it keeps the renderer it started
+	// with for the rest of the run
+	startScheduler.Do(func() {
+		renderer = &nopRenderer{}
+		go schedule()
+	})
+	nop := renderer.(*nopRenderer)
+	frames := nop.frames.Load()
+
+	keys := replayKeys(1_000_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		historyMu.Lock()
+		history = NewRing[*Key](1024)
+		historyMu.Unlock()
+
+		for _, key := range keys {
+			key.ID = nextKeyID()
+			key.Time = time.Now()
+			handleKey(&key)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.Elapsed())/float64(b.N*len(keys)), "ns/key")
+	b.ReportMetric(float64(nop.frames.Load()-frames)/float64(b.N), "frames/op")
+}
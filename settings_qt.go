@@ -0,0 +1,217 @@
+//go:build !noqt
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+	"github.com/mappu/miqt/qt6"
+)
+
+// Everything the settings window sets in the config file
+var settingNames = []string{
+	"iris", "tree", "rose", "gold", "love", "bg", "font", "timeout",
+	"spacing", "padding", "radius", "gap", "border-width", "cls+", "cls-", "evt+", "evt-",
+}
+
+// openSettings shows the settings window, making it the first time
+func (r *QtRenderer) openSettings() {
+	if r.settings == nil {
+		r.settings = r.newSettings()
+	}
+	r.settings.Show()
+	r.settings.Raise()
+	r.settings.ActivateWindow()
+}
+
+func (r *QtRenderer) newSettings() *qt6.QDialog {
+	dlg := qt6.NewQDialog(win)
+	dlg.SetWindowTitle("KbViz settings")
+	form := qt6.NewQFormLayout(dlg.QWidget)
+	status := qt6.NewQLabel3("")
+
+	palette := qt6.NewQHBoxLayout2()
+	for _, name := range []string{"iris", "tree", "rose", "gold", "love", "bg"} {
+		ptr := themeColors[name]
+		button := qt6.NewQPushButton3(name)
+		paint := func() {
+			button.SetStyleSheet(fmt.Sprintf("background-color: %s; color: %s;", *ptr, contrastColor(*ptr)))
+		}
+		paint()
+		button.OnClicked(func() {
+			color := qt6.QColorDialog_GetColor3(qt6.NewQColor6(*ptr), dlg.QWidget, name)
+			if color.IsValid() {
+				themeMu.Lock()
+				*ptr = color.Name()
+				themeMu.Unlock()
+				paint()
+				r.restyleAll()
+			}
+		})
+		palette.AddWidget(button.QWidget)
+	}
+	form.AddRow4("Palette", palette.QLayout)
+
+	fonts := qt6.NewQFontComboBox(nil)
+	fonts.SetCurrentFont(font)
+	fonts.OnCurrentFontChanged(func(f *qt6.QFont) {
+		*_flagFontFamily = f.Family()
+		font = qt6.NewQFont2(f.Family())
+		r.restyleAll()
+	})
+	form.AddRow3("Font", fonts.QWidget)
+
+	for _, name := range []string{"spacing", "padding", "radius", "gap", "border-width"} {
+		ptr := themeSizes[name]
+		spin := qt6.NewQSpinBox(nil)
+		spin.SetRange(0, 64)
+		spin.SetSuffix(" px")
+		spin.SetValue(*ptr)
+		spin.OnValueChanged(func(val int) {
+			themeMu.Lock()
+			*ptr = val
+			themeMu.Unlock()
+			r.restyleAll()
+		})
+		form.AddRow3(strings.ToUpper(name[:1])+strings.ReplaceAll(name[1:], "-", " "), spin.QWidget)
+	}
+
+	timeout := qt6.NewQSpinBox(nil)
+	timeout.SetRange(0, 3600)
+	timeout.SetSuffix(" s")
+	timeout.SetSpecialValueText("never")
+	timeout.SetValue(int(defaultTTL / time.Second))
+	timeout.OnValueChanged(func(val int) {
+		themeMu.Lock()
+		defaultTTL = time.Duration(val) * time.Second
+		themeMu.Unlock()
+		Redraw()
+	})
+	form.AddRow3("Timeout", timeout.QWidget)
+
+	// Devices are picked when kbviz starts, so a class only shows up if
+	// one of them has it
+	boxes := qt6.NewQGridLayout2()
+	types := slices.Sorted(maps.Keys(evStrMap))
+	types = slices.DeleteFunc(types, func(t evdev.EvType) bool { return t == evdev.EV_SYN })
+	for i, t := range types {
+		box := qt6.NewQCheckBox3(evdev.EVToString[t])
+		box.SetChecked(classes[t])
+		box.OnToggled(func(checked bool) {
+			filterMu.Lock()
+			classes[t] = checked
+			filterMu.Unlock()
+		})
+		boxes.AddWidget2(box.QWidget, i/4, i%4)
+	}
+	form.AddRow4("Event classes", boxes.QLayout)
+
+	ignored := []string{}
+	for _, t := range slices.Sorted(maps.Keys(ignoreEvt)) {
+		for _, code := range slices.Sorted(maps.Keys(ignoreEvt[t])) {
+			if ignoreEvt[t][code] {
+				ignored = append(ignored, evdev.CodeName(t, code))
+			}
+		}
+	}
+	codes := qt6.NewQPlainTextEdit3(strings.Join(ignored, "\n"))
+	codes.SetToolTip("One event per line, eg KEY_A or BTN_TOUCH")
+	codes.OnTextChanged(func() {
+		if err := setIgnored(codes.ToPlainText()); err != nil {
+			status.SetText(err.Error())
+		} else {
+			status.SetText("")
+		}
+	})
+	form.AddRow3("Ignored events", codes.QWidget)
+
+	buttons := qt6.NewQDialogButtonBox4(qt6.QDialogButtonBox__Save | qt6.QDialogButtonBox__Close)
+	buttons.OnAccepted(func() {
+		if err := saveConfig(settingNames, settingsConfig()); err != nil {
+			status.SetText(err.Error())
+		} else {
+			status.SetText("Saved to " + configPath())
+		}
+	})
+	buttons.OnRejected(dlg.Reject)
+	form.AddRow(status.QWidget, buttons.QWidget)
+	return dlg
+}
+
+// setIgnored replaces the ignored events with the ones listed one per line,
+// leaving them as they were if any line doesn't name an event
+func setIgnored(text string) error {
+	ignore := map[evdev.EvType]map[evdev.EvCode]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		t, code, err := evcode(line)
+		if err != nil {
+			return err
+		}
+		if ignore[t] == nil {
+			ignore[t] = map[evdev.EvCode]bool{}
+		}
+		ignore[t][code] = true
+	}
+
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	for t, codes := range ignoreEvt {
+		for code := range codes {
+			codes[code] = ignore[t][code]
+		}
+	}
+	for t, codes := range ignore {
+		if ignoreEvt[t] == nil {
+			ignoreEvt[t] = map[evdev.EvCode]bool{}
+		}
+		maps.Copy(ignoreEvt[t], codes)
+	}
+	return nil
+}
+
+// settingsConfig is the config lines for what the settings window shows
+func settingsConfig() []string {
+	lines := []string{}
+	for _, name := range []string{"iris", "tree", "rose", "gold", "love", "bg"} {
+		lines = append(lines, fmt.Sprintf("%s = %s", name, *themeColors[name]))
+	}
+	if *_flagFontFamily != "" {
+		lines = append(lines, "font = "+*_flagFontFamily)
+	}
+	lines = append(lines, fmt.Sprintf("timeout = %d", defaultTTL/time.Second))
+	for _, name := range []string{"spacing", "padding", "radius", "gap", "border-width"} {
+		lines = append(lines, fmt.Sprintf("%s = %d", name, *themeSizes[name]))
+	}
+
+	filterMu.RLock()
+	defer filterMu.RUnlock()
+	return append(lines, filterConfig()...)
+}
+
+// restyleAll makes every chip pick up changed settings on the next frame
+func (r *QtRenderer) restyleAll() {
+	styleWindow()
+	kblist.SetSpacing(themeSpacing)
+	for _, q := range slices.Concat(slices.Collect(maps.Values(r.chips)), r.pool) {
+		q.Layout.SetContentsMargins(themePadding, themePadding, themePadding, themePadding)
+		q.Layout.SetSpacing(themeGap)
+		q.HeadLayout.SetSpacing(themeGap)
+		q.FootLayout.SetSpacing(themeGap)
+		// Forces a refill without counting as a press
+		q.Key.ID = 0
+		q.Bg = ""
+	}
+	if kbview != nil {
+		kbview.Update()
+	}
+	Redraw()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StyleRule restyles the chips matching all of its selectors, eg
+//
+//	name KEY_F* and modifiers include ctrl: color=#ff0000 icon=Fn
+type StyleRule struct {
+	Match []func(Key) bool
+	Color string
+	Bg    string
+	Icon  string
+	// Minimum width in squares: the chip's height in the GUI, two columns
+	// in the terminal
+	Width float64
+}
+
+// ChipStyle is what the matching rules make of a chip, later rules winning.
+// Colors point into the rules like Segment colors point at the palette.
+type ChipStyle struct {
+	Color *string
+	Bg    *string
+	Icon  string
+	Width float64
+}
+
+var styleRules []StyleRule
+
+var modifierNames = map[string]func(ModSet[bool]) bool{
+	"shift": func(held ModSet[bool]) bool { return held.Shift },
+	"ctrl":  func(held ModSet[bool]) bool { return held.Ctrl },
+	"alt":   func(held ModSet[bool]) bool { return held.Alt },
+	"meta":  func(held ModSet[bool]) bool { return held.Meta },
+	"super": func(held ModSet[bool]) bool { return held.Meta },
+}
+
+var styleProp = regexp.MustCompile("^[a-zA-Z]+=")
+
+// cutStyle splits the rule at the last ':' followed by nothing but
+// properties, as selectors like device names can have colons of their own
+func cutStyle(val string) (string, string, bool) {
+	for i := strings.LastIndex(val, ":"); i >= 0; i = strings.LastIndex(val[:i], ":") {
+		props := strings.Fields(val[i+1:])
+		if !slices.ContainsFunc(props, func(prop string) bool { return !styleProp.MatchString(prop) }) {
+			return val[:i], val[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func applyStyle(val string) error {
+	selectors, props, ok := cutStyle(val)
+	if !ok {
+		return fmt.Errorf("not in proper format (eg class EV_REL: color=#33b473)")
+	}
+
+	rule := StyleRule{}
+	for _, sel := range strings.Split(selectors, " and ") {
+		match, err := parseSelector(strings.TrimSpace(sel))
+		if err != nil {
+			return err
+		}
+		rule.Match = append(rule.Match, match)
+	}
+
+	for _, prop := range strings.Fields(props) {
+		name, arg, ok := strings.Cut(prop, "=")
+		if !ok {
+			return fmt.Errorf("property `%s' is not in the form name=value", prop)
+		}
+		switch strings.ToLower(name) {
+		case "color":
+			if err := applyColor(&rule.Color)(arg); err != nil {
+				return fmt.Errorf("color: %w", err)
+			}
+		case "bg":
+			if err := applyColor(&rule.Bg)(arg); err != nil {
+				return fmt.Errorf("bg: %w", err)
+			}
+		case "icon":
+			rule.Icon = arg
+		case "width":
+			width, err := strconv.ParseFloat(arg, 64)
+			if err != nil || width <= 0 {
+				return fmt.Errorf("width `%s' isn't a positive number", arg)
+			}
+			rule.Width = width
+		default:
+			return fmt.Errorf("property `%s' doesn't exist (color, bg, icon, width)", name)
+		}
+	}
+
+	styleRules = append(styleRules, rule)
+	return nil
+}
+
+// parseSelector reads one of
+//
+//	modifiers include <mod>[,<mod>...]
+//	class <class>
+//	device matches <regexp>
+//	name <glob>
+func parseSelector(sel string) (func(Key) bool, error) {
+	kind, arg, _ := strings.Cut(sel, " ")
+	arg = strings.TrimSpace(arg)
+	switch strings.ToLower(kind) {
+	case "modifiers", "mods":
+		verb, list, _ := strings.Cut(arg, " ")
+		if strings.ToLower(verb) != "include" {
+			return nil, fmt.Errorf("selector `%s' should read `modifiers include <mod>'", sel)
+		}
+		held := []func(ModSet[bool]) bool{}
+		for _, name := range strings.Split(list, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			mod, ok := modifierNames[name]
+			if !ok {
+				return nil, fmt.Errorf("modifier `%s' doesn't exist (shift, ctrl, alt, meta)", name)
+			}
+			held = append(held, mod)
+		}
+		return func(key Key) bool {
+			for _, mod := range held {
+				if !mod(key.Held) {
+					return false
+				}
+			}
+			return true
+		}, nil
+
+	case "class":
+		t, err := evclass(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(key Key) bool { return key.Type == t }, nil
+
+	case "device":
+		verb, pattern, _ := strings.Cut(arg, " ")
+		if strings.ToLower(verb) == "name" {
+			verb, pattern, _ = strings.Cut(strings.TrimSpace(pattern), " ")
+		}
+		if strings.ToLower(verb) != "matches" {
+			return nil, fmt.Errorf("selector `%s' should read `device matches <regexp>'", sel)
+		}
+		re, err := regexp.Compile("(?i)" + strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, err
+		}
+		return func(key Key) bool { return re.MatchString(key.Device) }, nil
+
+	case "name":
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("pattern `%s': %w", arg, err)
+		}
+		return func(key Key) bool {
+			ok, _ := path.Match(arg, key.Name)
+			return ok
+		}, nil
+	}
+	return nil, fmt.Errorf("selector `%s' doesn't exist (modifiers include, class, device matches, name)", sel)
+}
+
+// Style merges the rules matching the chip
+func (key Key) Style() ChipStyle {
+	style := ChipStyle{}
+	for i := range styleRules {
+		rule := &styleRules[i]
+		matched := true
+		for _, match := range rule.Match {
+			if !match(key) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		if rule.Color != "" {
+			style.Color = &rule.Color
+		}
+		if rule.Bg != "" {
+			style.Bg = &rule.Bg
+		}
+		if rule.Icon != "" {
+			style.Icon = rule.Icon
+		}
+		if rule.Width > 0 {
+			style.Width = rule.Width
+		}
+	}
+	return style
+}
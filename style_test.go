@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+func TestApplyStyle(t *testing.T) {
+	ctrlF1 := Key{Type: evdev.EV_KEY, Code: evdev.KEY_F1, Name: "KEY_F1", Held: ModSet[bool]{Ctrl: true}, Device: "usb-0000:00:14.0-1/input0"}
+	for _, tt := range []struct {
+		name  string
+		rule  string
+		key   Key
+		match bool
+		icon  string
+	}{
+		{"plain", "name KEY_F*: icon=Fn", ctrlF1, true, "Fn"},
+		{"combined", "name KEY_F* and modifiers include ctrl: icon=Fn", ctrlF1, true, "Fn"},
+		{"combined miss", "name KEY_F* and modifiers include alt: icon=Fn", ctrlF1, false, ""},
+		{"colons in the device", "device matches 0000:00:14\\.0: icon=USB", ctrlF1, true, "USB"},
+		{"colons in the device miss", "device matches 0000:00:15\\.0: icon=USB", ctrlF1, false, ""},
+		{"colon in the icon", "name KEY_F1: icon=F:1", ctrlF1, true, "F:1"},
+		{"colons on both sides", "device matches :14\\.0-1: icon=a:b color=#ff0000", ctrlF1, true, "a:b"},
+		{"no properties", "class EV_KEY:", ctrlF1, true, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			old := styleRules
+			styleRules = nil
+			t.Cleanup(func() { styleRules = old })
+
+			if err := applyStyle(tt.rule); err != nil {
+				t.Fatal(err)
+			}
+			if len(styleRules) != 1 {
+				t.Fatalf("%d rules, want 1", len(styleRules))
+			}
+			matched := true
+			for _, match := range styleRules[0].Match {
+				matched = matched && match(tt.key)
+			}
+			if matched != tt.match {
+				t.Errorf("matched %v, want %v", matched, tt.match)
+			}
+			if icon := tt.key.Style().Icon; icon != tt.icon {
+				t.Errorf("icon %q, want %q", icon, tt.icon)
+			}
+		})
+	}
+}
+
+func TestApplyStyleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"name KEY_A",
+		"name KEY_A: colour=#ff0000",
+		"name KEY_A: color",
+		"name KEY_A: width=-1",
+		"shape round: color=#ff0000",
+		"modifiers include hyper: icon=H",
+		"device matches (: icon=x",
+	} {
+		t.Run(rule, func(t *testing.T) {
+			old := styleRules
+			styleRules = nil
+			t.Cleanup(func() { styleRules = old })
+
+			if err := applyStyle(rule); err == nil {
+				t.Errorf("applyStyle(%q) succeeded", rule)
+			}
+			if len(styleRules) != 0 {
+				t.Errorf("applyStyle(%q) added a rule", rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// ChipFields is what chip templates can show, eg
+//
+//	{{.Device}} {{.Time.Format "15:04:05"}} held {{.Hold}}
+type ChipFields struct {
+	Label    string
+	Mods     string
+	Count    int
+	Code     int
+	Scancode int
+	Name     string
+	Device   string
+	Mode     string
+	Action   string
+	Time     time.Time
+	Hold     time.Duration
+}
+
+// The chip slots that can be templated, named after what they show by
+// default: code top left, count top right, label in the middle and the
+// modifier bulbs along the bottom
+var slotTemplates = map[string]*template.Template{"code": nil, "count": nil, "label": nil, "bulbs": nil}
+
+var (
+	// Replaces the whole chip in the terminal
+	termTemplate    *template.Template
+	hideHeader      bool
+	hideFooter      bool
+	_flagHideHeader *bool
+	_flagHideFooter *bool
+)
+
+func applySlot(val string) error {
+	slot, text, ok := strings.Cut(val, "=")
+	if !ok {
+		return fmt.Errorf("not in proper format (eg code={{.Device}})")
+	}
+	if _, ok := slotTemplates[slot]; !ok {
+		return fmt.Errorf("slot `%s' doesn't exist (code, count, label, bulbs)", slot)
+	}
+	tmpl, err := parseTemplate(slot, text)
+	if err != nil {
+		return err
+	}
+	slotTemplates[slot] = tmpl
+	return nil
+}
+
+func applyTemplate(val string) error {
+	tmpl, err := parseTemplate("chip", val)
+	if err != nil {
+		return err
+	}
+	termTemplate = tmpl
+	return nil
+}
+
+// parseTemplate parses the template and tries it on an empty chip, so
+// fields that don't exist are caught with the flag instead of on every chip
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, ChipFields{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (key Key) Fields() ChipFields {
+	label, shifted := key.Label()
+	mods := ""
+	if key.Held.Meta {
+		mods += modChar.Meta
+	}
+	if key.Held.Ctrl {
+		mods += modChar.Ctrl
+	}
+	if key.Held.Alt {
+		mods += modChar.Alt
+	}
+	if key.Held.Shift && !shifted {
+		mods += modChar.Shift
+	}
+
+	return ChipFields{
+		Label:    segmentsText(label),
+		Mods:     mods,
+		Count:    key.Count,
+		Code:     int(key.Code),
+		Scancode: key.Scancode,
+		Name:     key.Name,
+		Device:   key.Device,
+		Mode:     key.Mode,
+		Action:   key.Action,
+		Time:     key.Time,
+		Hold:     key.Hold,
+	}
+}
+
+// Expand fills in the template for the chip. A template that fails part
+// way shows what it got to and why it stopped.
+func (key Key) Expand(tmpl *template.Template) string {
+	buf := strings.Builder{}
+	if err := tmpl.Execute(&buf, key.Fields()); err != nil {
+		fmt.Fprintf(&buf, "<%s>", err)
+	}
+	return buf.String()
+}
+
+// heldKey is a key on a particular device, as the same key can be held on
+// two keyboards at once
+type heldKey struct {
+	device string
+	code   evdev.EvCode
+}
+
+// Presses waiting on their release, for the chips' hold time. Guarded by
+// historyMu.
+var pressedAt = map[heldKey]time.Time{}
+
+// recordHold times how long a key was held, putting it on the newest chip
+// for the key from that device when it's released
+func recordHold(device string, evt *evdev.InputEvent) {
+	if evt.Type != evdev.EV_KEY || evt.Value == 2 {
+		return
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	held := heldKey{device, evt.Code}
+	if evt.Value == 1 {
+		pressedAt[held] = time.Now()
+		return
+	}
+
+	at, ok := pressedAt[held]
+	if !ok {
+		return
+	}
+	delete(pressedAt, held)
+	for i := history.Len() - 1; i >= 0; i-- {
+		if key := history.At(i); key.Type == evdev.EV_KEY && key.Code == evt.Code && key.Device == device {
+			key.Hold = time.Since(at)
+			Redraw()
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/holoplot/go-evdev"
+)
+
+// fieldsKey is a key press like makeKey would give, with a scancode
+func fieldsKey(code evdev.EvCode, held ModSet[bool]) Key {
+	char, found := tokens[evdev.EV_KEY][code]
+	return Key{
+		Type: evdev.EV_KEY, Code: code, Name: evdev.CodeName(evdev.EV_KEY, code),
+		Char: char, Found: found, Held: held, Count: 2, Scancode: 0x7001e,
+		Device: "kbd", Mode: "n", Action: "Find files", Time: epoch, Hold: 80 * time.Millisecond,
+	}
+}
+
+func TestFields(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		key   Key
+		label string
+		mods  string
+	}{
+		{"plain", fieldsKey(evdev.KEY_A, ModSet[bool]{}), "a", ""},
+		{"modifiers", fieldsKey(evdev.KEY_A, ModSet[bool]{Ctrl: true, Meta: true}), "a", modChar.Meta + modChar.Ctrl},
+		{"every modifier", fieldsKey(evdev.KEY_A, ModSet[bool]{Ctrl: true, Alt: true, Meta: true, Shift: true}), "A", modChar.Meta + modChar.Ctrl + modChar.Alt},
+		// The label already shows shift
+		{"shifted", fieldsKey(evdev.KEY_1, ModSet[bool]{Shift: true}), "!", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.key.Fields()
+			if f.Label != tt.label || f.Mods != tt.mods {
+				t.Errorf("label %q, mods %q; want %q, %q", f.Label, f.Mods, tt.label, tt.mods)
+			}
+			if f.Count != 2 || f.Code != int(tt.key.Code) || f.Scancode != 0x7001e || f.Name != tt.key.Name ||
+				f.Device != "kbd" || f.Mode != "n" || f.Action != "Find files" || !f.Time.Equal(epoch) || f.Hold != 80*time.Millisecond {
+				t.Errorf("fields %+v don't match the key", f)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	oldTerm := termTemplate
+	t.Cleanup(func() { termTemplate = oldTerm })
+
+	key := fieldsKey(evdev.KEY_A, ModSet[bool]{Ctrl: true})
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"{{.Label}}", "a"},
+		{"{{.Mods}}{{.Label}}×{{.Count}}", modChar.Ctrl + "a×2"},
+		{"{{.Device}} {{.Time.Format \"15:04:05\"}} held {{.Hold}}", "kbd 00:00:00 held 80ms"},
+		{"{{printf \"%x\" .Scancode}} {{.Name}}/{{.Code}}", "7001e KEY_A/30"},
+		{"{{if .Action}}{{.Action}}{{else}}{{.Label}}{{end}}", "Find files"},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			if err := applyTemplate(tt.text); err != nil {
+				t.Fatal(err)
+			}
+			if got := key.Expand(termTemplate); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Failing part way keeps what came before and says why
+	tmpl := template.Must(template.New("chip").Parse(`{{.Label}}-{{index .Label 5}}`))
+	if got := key.Expand(tmpl); !strings.HasPrefix(got, "a-<") || !strings.Contains(got, "index out of range") {
+		t.Errorf("failed expansion gave %q", got)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	oldTerm, oldSlots := termTemplate, slotTemplates
+	slotTemplates = map[string]*template.Template{"code": nil, "count": nil, "label": nil, "bulbs": nil}
+	t.Cleanup(func() { termTemplate, slotTemplates = oldTerm, oldSlots })
+
+	for _, val := range []string{"{{.Label", "{{.Nope}}", "{{.Label.Text}}", "{{.Count.Seconds}}", "{{nope}}"} {
+		if err := applyTemplate(val); err == nil {
+			t.Errorf("applyTemplate(%q) succeeded", val)
+		}
+		if err := applySlot("label=" + val); err == nil {
+			t.Errorf("applySlot(label=%q) succeeded", val)
+		}
+	}
+	if termTemplate != oldTerm || slotTemplates["label"] != nil {
+		t.Error("a bad template was kept")
+	}
+	for _, val := range []string{"label", "nope={{.Label}}"} {
+		if err := applySlot(val); err == nil {
+			t.Errorf("applySlot(%q) succeeded", val)
+		}
+	}
+}
+
+func TestRecordHold(t *testing.T) {
+	oldHistory := history
+	t.Cleanup(func() {
+		history = oldHistory
+		clear(pressedAt)
+	})
+
+	key := func(device string, code evdev.EvCode) *Key {
+		key := testKey(evdev.EV_KEY, code, 0)
+		key.Device = device
+		return key
+	}
+	evt := func(code evdev.EvCode, value int32) *evdev.InputEvent {
+		return &evdev.InputEvent{Type: evdev.EV_KEY, Code: code, Value: value}
+	}
+
+	history = NewRing[*Key](8)
+	a1, a2, b1 := key("kbd1", evdev.KEY_A), key("kbd2", evdev.KEY_A), key("kbd1", evdev.KEY_B)
+	for _, k := range []*Key{a1, a2, b1} {
+		history.Push(k)
+	}
+
+	recordHold("kbd1", evt(evdev.KEY_A, 1))
+	recordHold("kbd2", evt(evdev.KEY_A, 1))
+	time.Sleep(20 * time.Millisecond)
+	// Repeats and other event types don't end the hold
+	recordHold("kbd1", evt(evdev.KEY_A, 2))
+	recordHold("kbd1", &evdev.InputEvent{Type: evdev.EV_REL, Code: evdev.REL_X, Value: 0})
+	recordHold("kbd1", evt(evdev.KEY_A, 0))
+
+	if a1.Hold < 20*time.Millisecond {
+		t.Errorf("kbd1's A held %s, want at least 20ms", a1.Hold)
+	}
+	if a2.Hold != 0 {
+		t.Errorf("kbd2's A held %s while it's still down", a2.Hold)
+	}
+	if b1.Hold != 0 {
+		t.Errorf("B held %s without being pressed", b1.Hold)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	recordHold("kbd2", evt(evdev.KEY_A, 0))
+	if a2.Hold < 30*time.Millisecond {
+		t.Errorf("kbd2's A held %s, want at least 30ms", a2.Hold)
+	}
+	// A release without a press is left alone
+	recordHold("kbd1", evt(evdev.KEY_B, 0))
+	if b1.Hold != 0 || len(pressedAt) != 0 {
+		t.Errorf("B held %s, %d presses left", b1.Hold, len(pressedAt))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/holoplot/go-evdev"
+)
+
+var (
+	textMode  bool
+	_flagText *bool
+)
+
+var modifierKeys = map[evdev.EvCode]bool{
+	evdev.KEY_LEFTSHIFT:  true,
+	evdev.KEY_RIGHTSHIFT: true,
+	evdev.KEY_LEFTCTRL:   true,
+	evdev.KEY_RIGHTCTRL:  true,
+	evdev.KEY_LEFTALT:    true,
+	evdev.KEY_RIGHTALT:   true,
+	evdev.KEY_LEFTMETA:   true,
+	evdev.KEY_RIGHTMETA:  true,
+}
+
+// textChar returns what the key would type using the labels in `tokens', so
+// -S overrides and the shift table are honored
+func textChar(key *Key) (string, bool) {
+	if key.Type != evdev.EV_KEY || !key.Found || key.Held.Ctrl || key.Held.Alt || key.Held.Meta {
+		return "", false
+	}
+	if key.Code == evdev.KEY_SPACE {
+		return " ", true
+	}
+
+	r, _ := utf8.DecodeRuneInString(key.Char)
+	if utf8.RuneCountInString(key.Char) != 1 || r >= 255 || !unicode.IsPrint(r) {
+		return "", false
+	}
+
+	char := strings.ToLower(key.Char)
+	if key.Held.Shift {
+		if shift, ok := shifts[char]; ok {
+			char = shift
+		} else {
+			char = strings.ToUpper(char)
+		}
+	}
+	return char, true
+}
+
+func deleteWord(text string) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	idx := strings.LastIndexFunc(text, unicode.IsSpace)
+	return text[:idx+1]
+}
+
+// typeText folds the key into the open text chip at the end of history and
+// returns that chip. Returns nil when the key should be handled as a regular
+// chip instead. Must be called with historyMu held.
+func typeText(key *Key) *Key {
+	open, ok := history.Last()
+	if ok && !open.Open {
+		open = nil
+	}
+
+	char, printable := textChar(key)
+	switch {
+	case printable:
+		if open == nil {
+			open = &Key{
+				ID:    nextKeyID(),
+				Type:  key.Type,
+				Name:  "TEXT",
+				Found: true,
+				Text:  true,
+				Open:  true,
+				Count: 1,
+				Time:  key.Time,
+			}
+			history.Push(open)
+		}
+		open.Char += char
+		open.Time = key.Time
+	case open == nil:
+		return nil
+	case key.Type == evdev.EV_KEY && modifierKeys[key.Code]:
+		// Tapping a modifier on its own shouldn't break up a word
+	case key.Type == evdev.EV_KEY && key.Code == evdev.KEY_BACKSPACE && !key.Held.Alt && !key.Held.Meta:
+		if key.Held.Ctrl {
+			open.Char = deleteWord(open.Char)
+		} else {
+			_, sz := utf8.DecodeLastRuneInString(open.Char)
+			open.Char = open.Char[:len(open.Char)-sz]
+		}
+		if open.Char == "" {
+			history.Remove(history.Len() - 1)
+		}
+	default:
+		open.Open = false
+		return nil
+	}
+
+	return open
+}
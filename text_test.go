@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/holoplot/go-evdev"
+)
+
+func TestTypeText(t *testing.T) {
+	press := func(code evdev.EvCode, held ModSet[bool]) *Key {
+		char, found := tokens[evdev.EV_KEY][code]
+		return &Key{Type: evdev.EV_KEY, Code: code, Name: evdev.CodeName(evdev.EV_KEY, code), Char: char, Found: found, Held: held, Count: 1}
+	}
+	none, shift, ctrl := ModSet[bool]{}, ModSet[bool]{Shift: true}, ModSet[bool]{Ctrl: true}
+	// Shares its code with KEY_BACKSPACE
+	axis := &Key{Type: evdev.EV_ABS, Code: evdev.KEY_BACKSPACE, Name: "ABS_14", Count: 1}
+
+	for _, tt := range []struct {
+		name string
+		keys []*Key
+		text string
+		open bool
+		// Chips in the history besides the text
+		others int
+	}{
+		{"typing", []*Key{press(evdev.KEY_H, shift), press(evdev.KEY_I, none), press(evdev.KEY_1, shift)}, "Hi!", true, 0},
+		{"space", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_SPACE, none), press(evdev.KEY_B, none)}, "a b", true, 0},
+		{"modifier tap", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_LEFTSHIFT, none), press(evdev.KEY_B, none)}, "ab", true, 0},
+		{"backspace", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_B, none), press(evdev.KEY_BACKSPACE, none)}, "a", true, 0},
+		{"ctrl backspace", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_SPACE, none), press(evdev.KEY_B, none), press(evdev.KEY_C, none), press(evdev.KEY_BACKSPACE, ctrl)}, "a ", true, 0},
+		{"backspace to nothing", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_BACKSPACE, none)}, "", false, 0},
+		{"shortcut closes", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_C, ctrl)}, "a", false, 1},
+		{"other classes close", []*Key{press(evdev.KEY_A, none), press(evdev.KEY_B, none), axis}, "ab", false, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			old := history
+			history = NewRing[*Key](16)
+			t.Cleanup(func() { history = old })
+
+			for _, key := range tt.keys {
+				if typeText(key) == nil {
+					history.Push(key)
+				}
+			}
+
+			text, others := "", 0
+			open := false
+			for i := range history.Len() {
+				if chip := history.At(i); chip.Text {
+					text, open = chip.Char, chip.Open
+				} else {
+					others++
+				}
+			}
+			if text != tt.text || open != tt.open || others != tt.others {
+				t.Errorf("text %q open %v with %d others, want %q open %v with %d others", text, open, others, tt.text, tt.open, tt.others)
+			}
+		})
+	}
+}
+
+func TestDeleteWord(t *testing.T) {
+	for text, want := range map[string]string{
+		"":           "",
+		"word":       "",
+		"two words":  "two ",
+		"trailing  ": "",
+		"a b  ":      "a ",
+		"tab\tword":  "tab\t",
+	} {
+		if got := deleteWord(text); got != want {
+			t.Errorf("deleteWord(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
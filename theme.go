@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// themeMu guards the palette, the theme and the timeout, which the settings
+// window and tray change from the Qt thread while the scheduler draws
+var themeMu sync.RWMutex
+
+// Theme roles past the six palette colors. Empty colors follow the system.
+var (
+	themeFg          = ""
+	themeBorder      = ""
+	themeWindow      = ""
+	themeBorderWidth = 0
+	themeRadius      = 4
+	themePadding     = 4
+	themeSpacing     = 4
+	themeGap         = 1
+	themeWeight      = ""
+	themeBold        = "bold"
+	// Extra stylesheet for each part of a chip in the GUI
+	partStyles = map[string]string{"keyname": "", "keycode": "", "repcount": "", "bulbs": ""}
+)
+
+var themeColors = map[string]*string{
+	"iris": &sakuraIris, "tree": &sakuraTree, "rose": &sakuraRose, "gold": &sakuraGold,
+	"love": &sakuraLove, "bg": &sakuraBg, "fg": &themeFg, "border": &themeBorder, "window": &themeWindow,
+}
+
+// Colors that can be left empty to follow the system
+var systemColors = []string{"fg", "border", "window"}
+
+var themeSizes = map[string]*int{
+	"border-width": &themeBorderWidth, "radius": &themeRadius, "padding": &themePadding,
+	"spacing": &themeSpacing, "gap": &themeGap,
+}
+
+var themeWeights = map[string]*string{"weight": &themeWeight, "bold": &themeBold}
+
+// Built-in themes, in the same format as theme files. Every theme is
+// applied on top of light.
+var themes = map[string]string{
+	"light": `
+iris: "#696ac2"
+tree: "#33b473"
+rose: "#d875a7"
+gold: "#b4b433"
+love: "#d87576"
+bg: "#f2e1ea"
+fg: ""
+border: ""
+window: ""
+border-width: 0
+radius: 4
+padding: 4
+spacing: 4
+gap: 1
+weight: ""
+bold: bold
+keyname: ""
+keycode: ""
+repcount: ""
+bulbs: ""
+`,
+	"dark": `
+iris: "#c4a7e7"
+tree: "#9ccfd8"
+rose: "#ebbcba"
+gold: "#f6c177"
+love: "#eb6f92"
+bg: "#26233a"
+fg: "#e0def4"
+window: "#191724"
+`,
+	"high-contrast": `
+iris: "#00ffff"
+tree: "#00ff00"
+rose: "#ff00ff"
+gold: "#ffff00"
+love: "#ff5555"
+bg: "#000000"
+fg: "#ffffff"
+border: "#ffffff"
+window: "#000000"
+border-width: 2
+radius: 0
+weight: bold
+bold: 900
+`,
+}
+
+// base16 and base24 schemes only fill in the colors, and say which scheme
+// they are
+var base16Meta = []string{"scheme", "author", "name", "slug", "system", "variant", "description"}
+
+// Roles taken from a base16 scheme: backgrounds from the dark end, accents
+// from the colored end
+var base16Roles = map[string]string{
+	"window": "base00", "bg": "base01", "border": "base03", "fg": "base05",
+	"love": "base08", "gold": "base0A", "tree": "base0B", "iris": "base0D", "rose": "base0E",
+}
+
+// The last theme applied, by name or path
+var currentTheme = "light"
+
+var bareHex = regexp.MustCompile("^[a-fA-F0-9]{6}$")
+
+func applyTheme(val string) error {
+	data, ok := themes[strings.ToLower(val)]
+	if !ok {
+		raw, err := os.ReadFile(val)
+		if err != nil {
+			return fmt.Errorf("theme `%s' doesn't exist (light, dark, high-contrast or a file)", val)
+		}
+		data = string(raw)
+	}
+
+	if err := loadTheme(themes["light"]); err != nil {
+		return err
+	}
+	if err := loadTheme(data); err != nil {
+		return fmt.Errorf("theme `%s': %w", val, err)
+	}
+	currentTheme = val
+	return nil
+}
+
+// themeFiles lists the theme files in ~/.config/kbviz/themes, which the
+// tray offers next to the built-in themes
+func themeFiles() []string {
+	path := configPath()
+	if path == "" {
+		return nil
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "themes", "*"))
+	return files
+}
+
+// parseTheme reads the flat `key: value' lines of a theme or base16 scheme.
+// Keys without a value, like base16's `palette:', only group the lines
+// under them.
+func parseTheme(data string) (map[string]string, error) {
+	values := map[string]string{}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: not in the form key: value", i+1)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+		if val == "" {
+			continue
+		}
+
+		if quote := val[0]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(val[1:], quote)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			val = val[1 : end+1]
+		} else if at := strings.Index(val, " #"); at >= 0 {
+			val = strings.TrimSpace(val[:at])
+		}
+		values[key] = val
+	}
+	return values, nil
+}
+
+func loadTheme(data string) error {
+	values, err := parseTheme(data)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := values["base00"]; ok {
+		scheme := values
+		values = map[string]string{}
+		for role, base := range base16Roles {
+			if color, ok := scheme[strings.ToLower(base)]; ok {
+				values[role] = color
+			}
+		}
+	}
+
+	for key, val := range values {
+		if slices.Contains(base16Meta, key) {
+			continue
+		}
+		if ptr, ok := themeColors[key]; ok {
+			if bareHex.MatchString(val) {
+				val = "#" + val
+			}
+			if val == "" && slices.Contains(systemColors, key) {
+				*ptr = ""
+			} else if err := applyColor(ptr)(val); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		} else if ptr, ok := themeSizes[key]; ok {
+			size, err := strconv.Atoi(val)
+			if err != nil || size < 0 {
+				return fmt.Errorf("%s: `%s' isn't a size in pixels", key, val)
+			}
+			*ptr = size
+		} else if ptr, ok := themeWeights[key]; ok {
+			*ptr = val
+		} else if _, ok := partStyles[key]; ok {
+			partStyles[key] = val
+		} else {
+			return fmt.Errorf("key `%s' doesn't exist", key)
+		}
+	}
+	return nil
+}
+
+// textColor is the color of plain text on the background: the theme's for
+// the chip background when it sets one, black or white otherwise
+func textColor(bg string) string {
+	if themeFg != "" && bg == sakuraBg {
+		return themeFg
+	}
+	return contrastColor(bg)
+}
+
+// chipBorder is the color keycaps are outlined in
+func chipBorder() *string {
+	if themeBorder != "" {
+		return &themeBorder
+	}
+	return &sakuraBg
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// themeState reads every theme key back the way a theme file would set it
+func themeState() map[string]string {
+	state := maps.Clone(partStyles)
+	for key, ptr := range themeColors {
+		state[key] = *ptr
+	}
+	for key, ptr := range themeSizes {
+		state[key] = strconv.Itoa(*ptr)
+	}
+	for key, ptr := range themeWeights {
+		state[key] = *ptr
+	}
+	return state
+}
+
+// withTheme puts the theme back the way it was after the test, starting it
+// from light
+func withTheme(t *testing.T) {
+	t.Helper()
+	old, oldCurrent := themeState(), currentTheme
+	t.Cleanup(func() {
+		for key, val := range old {
+			if ptr, ok := themeColors[key]; ok {
+				*ptr = val
+			} else if ptr, ok := themeSizes[key]; ok {
+				*ptr, _ = strconv.Atoi(val)
+			} else if ptr, ok := themeWeights[key]; ok {
+				*ptr = val
+			} else {
+				partStyles[key] = val
+			}
+		}
+		currentTheme = oldCurrent
+	})
+	if err := applyTheme("light"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"plain", "iris: #696ac2\nradius: 4", map[string]string{"iris": "#696ac2", "radius": "4"}},
+		{"keys any case", "Border-Width: 2", map[string]string{"border-width": "2"}},
+		{"double quotes", `iris: "#696ac2"`, map[string]string{"iris": "#696ac2"}},
+		{"single quotes", `keyname: 'font: 12px "Iosevka"'`, map[string]string{"keyname": `font: 12px "Iosevka"`}},
+		{"quoted empty", `fg: ""`, map[string]string{"fg": ""}},
+		{"comment after quotes", `bg: "#000000" # black`, map[string]string{"bg": "#000000"}},
+		{"inline comment", "radius: 6 # rounder", map[string]string{"radius": "6"}},
+		{"hash without space", "iris: #696ac2#x", map[string]string{"iris": "#696ac2#x"}},
+		{"comment lines", "# my theme\n  # indented\niris: 696ac2", map[string]string{"iris": "696ac2"}},
+		{"blank and group lines", "\npalette:\n  base00: \"181818\"\n\n", map[string]string{"base00": "181818"}},
+		{"later wins", "gap: 1\ngap: 2", map[string]string{"gap": "2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTheme(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, data := range []string{"iris #696ac2", `bg: "#000000`, "fg: 'white"} {
+		if _, err := parseTheme(data); err == nil {
+			t.Errorf("parseTheme(%q) succeeded", data)
+		}
+	}
+}
+
+// A base16 scheme as it used to be written, with everything at the top
+const base16Flat = `scheme: "Default Dark"
+author: "Chris Kempson (http://chriskempson.com)"
+base00: "181818"
+base01: "282828"
+base02: "383838"
+base03: "585858"
+base04: "b8b8b8"
+base05: "d8d8d8"
+base06: "e8e8e8"
+base07: "f8f8f8"
+base08: "ab4642"
+base09: "dc9656"
+base0A: "f7ca88"
+base0B: "a1b56c"
+base0C: "86c1b9"
+base0D: "7cafc2"
+base0E: "ba8baf"
+base0F: "a16946"
+`
+
+// The same scheme in the tinted-theming layout, with the colors under
+// palette:
+const base16Palette = `system: "base16"
+name: "Default Dark"
+author: "Chris Kempson (http://chriskempson.com)"
+variant: "dark"
+palette:
+  base00: "#181818"
+  base01: "#282828"
+  base02: "#383838"
+  base03: "#585858"
+  base04: "#b8b8b8"
+  base05: "#d8d8d8"
+  base06: "#e8e8e8"
+  base07: "#f8f8f8"
+  base08: "#ab4642"
+  base09: "#dc9656"
+  base0A: "#f7ca88"
+  base0B: "#a1b56c"
+  base0C: "#86c1b9"
+  base0D: "#7cafc2"
+  base0E: "#ba8baf"
+  base0F: "#a16946"
+`
+
+func TestLoadTheme(t *testing.T) {
+	base16 := map[string]string{
+		"window": "#181818", "bg": "#282828", "border": "#585858", "fg": "#d8d8d8",
+		"love": "#ab4642", "gold": "#f7ca88", "tree": "#a1b56c", "iris": "#7cafc2", "rose": "#ba8baf",
+		// Only the colors come from the scheme
+		"radius": "4", "border-width": "0",
+	}
+	for _, tt := range []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"base16", base16Flat, base16},
+		{"base16 palette", base16Palette, base16},
+		{"bare hex", "iris: 112233\nbg: '#445566'", map[string]string{"iris": "#112233", "bg": "#445566"}},
+		{"sizes", "radius: 0\nborder-width: 3 # thick", map[string]string{"radius": "0", "border-width": "3"}},
+		{"weights and parts", "weight: 300\nkeyname: 'font-style: italic;'", map[string]string{"weight": "300", "keyname": "font-style: italic;"}},
+		{"system colors", "fg: '#ffffff'\nwindow: \"#000000\"\nfg: \"\"", map[string]string{"fg": "", "window": "#000000"}},
+		{"key without a value", "iris:\n", map[string]string{"iris": "#696ac2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withTheme(t)
+			if err := loadTheme(tt.data); err != nil {
+				t.Fatal(err)
+			}
+			state := themeState()
+			for key, want := range tt.want {
+				if state[key] != want {
+					t.Errorf("%s is %q, want %q", key, state[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadThemeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"unknown key", "colour: #ffffff"},
+		{"negative size", "radius: -2"},
+		{"size with units", "padding: 4px"},
+		{"bad color", "iris: purple"},
+		{"short hex", "iris: #fff"},
+		// Only the system colors can be left to the system
+		{"empty palette color", `bg: ""`},
+		{"not key: value", "just some words"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withTheme(t)
+			if err := loadTheme(tt.data); err == nil {
+				t.Errorf("loadTheme(%q) succeeded", tt.data)
+			}
+		})
+	}
+}
+
+func TestApplyTheme(t *testing.T) {
+	withTheme(t)
+	light := themeState()
+
+	// A file only says what it changes, the rest comes from light and not
+	// from whatever was applied before it
+	path := filepath.Join(t.TempDir(), "mine")
+	if err := os.WriteFile(path, []byte("# just the accents\niris: \"#010203\"\ngap: 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"high-contrast", "dark"} {
+		if err := applyTheme(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyTheme(path); err != nil {
+			t.Fatal(err)
+		}
+		state := themeState()
+		for key, want := range light {
+			switch key {
+			case "iris":
+				want = "#010203"
+			case "gap":
+				want = "3"
+			}
+			if state[key] != want {
+				t.Errorf("after %s, %s is %q, want %q", name, key, state[key], want)
+			}
+		}
+		if currentTheme != path {
+			t.Errorf("current theme %q, want %q", currentTheme, path)
+		}
+	}
+
+	if err := applyTheme("DARK"); err != nil || themeFg != "#e0def4" || themeWindow != "#191724" {
+		t.Errorf("dark by any case: %v, fg %q, window %q", err, themeFg, themeWindow)
+	}
+	if err := applyTheme(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("applied a theme that doesn't exist")
+	}
+}
@@ -0,0 +1,101 @@
+//go:build !noqt
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mappu/miqt/qt6"
+)
+
+// newTray puts kbviz in the system tray, for when the window is an overlay
+// that can't be clicked
+func (r *QtRenderer) newTray(icon *qt6.QIcon) {
+	if !*_flagTray || !qt6.QSystemTrayIcon_IsSystemTrayAvailable() {
+		return
+	}
+
+	paused := qt6.NewQIcon2(icon.Pixmap7(64, 64, qt6.QIcon__Disabled))
+	tray := qt6.NewQSystemTrayIcon4(icon, win.QObject)
+	tray.SetToolTip("KbViz")
+	menu := qt6.NewQMenu2()
+
+	pause := menu.AddActionWithText("Pause capture")
+	pause.SetCheckable(true)
+	pause.OnToggled(func(checked bool) {
+		capturePaused.Store(checked)
+		if checked {
+			tray.SetIcon(paused)
+			tray.SetToolTip("KbViz (paused)")
+		} else {
+			tray.SetIcon(icon)
+			tray.SetToolTip("KbViz")
+		}
+	})
+
+	menu.AddActionWithText("Clear history").OnTriggered(func() {
+		historyMu.Lock()
+		history.Clear()
+		historyMu.Unlock()
+		Redraw()
+	})
+	menu.AddSeparator()
+
+	overlay := menu.AddActionWithText("Overlay")
+	overlay.SetCheckable(true)
+	overlay.SetChecked(overlayMode)
+	through := menu.AddActionWithText("Click-through")
+	through.SetCheckable(true)
+	through.SetChecked(clickThrough)
+	through.SetEnabled(overlayMode)
+	overlay.OnToggled(func(checked bool) {
+		overlayMode = checked
+		through.SetEnabled(checked)
+		applyOverlay()
+	})
+	through.OnToggled(func(checked bool) {
+		clickThrough = checked
+		applyOverlay()
+	})
+
+	// Profiles are the themes, built-in and from ~/.config/kbviz/themes
+	profiles := qt6.NewQMenu3("Profile")
+	profiles.OnAboutToShow(func() {
+		profiles.Clear()
+		for _, name := range slices.Concat(slices.Sorted(maps.Keys(themes)), themeFiles()) {
+			action := profiles.AddActionWithText(filepath.Base(name))
+			action.SetCheckable(true)
+			action.SetChecked(name == currentTheme)
+			action.OnTriggered(func() {
+				themeMu.Lock()
+				err := applyTheme(name)
+				themeMu.Unlock()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "theme: \x1b[91;1m%s\x1b[0m\n", err.Error())
+					return
+				}
+				if r.settings != nil {
+					// Its palette and sizes are out of date now
+					r.settings.Close()
+					r.settings.DeleteLater()
+					r.settings = nil
+				}
+				r.restyleAll()
+			})
+		}
+	})
+	menu.AddMenu(profiles)
+
+	menu.AddActionWithText("Settings…").OnTriggered(r.openSettings)
+	menu.AddSeparator()
+	menu.AddActionWithText("Quit").OnTriggered(func() {
+		win.Close()
+	})
+
+	tray.SetContextMenu(menu)
+	tray.Show()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type glyphRange struct {
+	lo, hi rune
+	width  int
+}
+
+var (
+	ambiguousWidth = 1
+	privateWidth   = 1
+	// glyphWidths is checked before anything else, so users can fix up
+	// whatever their terminal and font disagree on
+	glyphWidths = []glyphRange{}
+)
+
+// East Asian Wide and Fullwidth, plus emoji with emoji presentation
+var wideGlyphs = []glyphRange{
+	{0x1100, 0x115f, 2}, {0x231a, 0x231b, 2}, {0x2329, 0x232a, 2}, {0x23e9, 0x23ec, 2},
+	{0x23f0, 0x23f0, 2}, {0x23f3, 0x23f3, 2}, {0x25fd, 0x25fe, 2}, {0x2614, 0x2615, 2},
+	{0x2648, 0x2653, 2}, {0x267f, 0x267f, 2}, {0x2693, 0x2693, 2}, {0x26a1, 0x26a1, 2},
+	{0x26aa, 0x26ab, 2}, {0x26bd, 0x26be, 2}, {0x26c4, 0x26c5, 2}, {0x26ce, 0x26ce, 2},
+	{0x26d4, 0x26d4, 2}, {0x26ea, 0x26ea, 2}, {0x26f2, 0x26f3, 2}, {0x26f5, 0x26f5, 2},
+	{0x26fa, 0x26fa, 2}, {0x26fd, 0x26fd, 2}, {0x2705, 0x2705, 2}, {0x270a, 0x270b, 2},
+	{0x2728, 0x2728, 2}, {0x274c, 0x274c, 2}, {0x274e, 0x274e, 2}, {0x2753, 0x2755, 2},
+	{0x2757, 0x2757, 2}, {0x2795, 0x2797, 2}, {0x27b0, 0x27b0, 2}, {0x27bf, 0x27bf, 2},
+	{0x2b1b, 0x2b1c, 2}, {0x2b50, 0x2b50, 2}, {0x2b55, 0x2b55, 2}, {0x2e80, 0x303e, 2},
+	{0x3041, 0x33ff, 2}, {0x3400, 0x4dbf, 2}, {0x4e00, 0x9fff, 2}, {0xa000, 0xa4cf, 2},
+	{0xa960, 0xa97f, 2}, {0xac00, 0xd7a3, 2}, {0xf900, 0xfaff, 2}, {0xfe10, 0xfe19, 2},
+	{0xfe30, 0xfe6f, 2}, {0xff00, 0xff60, 2}, {0xffe0, 0xffe6, 2}, {0x16fe0, 0x16fe4, 2},
+	{0x17000, 0x18aff, 2}, {0x1b000, 0x1b2ff, 2}, {0x1f004, 0x1f004, 2}, {0x1f0cf, 0x1f0cf, 2},
+	{0x1f18e, 0x1f18e, 2}, {0x1f191, 0x1f19a, 2}, {0x1f200, 0x1f251, 2}, {0x1f300, 0x1f320, 2},
+	{0x1f32d, 0x1f335, 2}, {0x1f337, 0x1f37c, 2}, {0x1f37e, 0x1f393, 2}, {0x1f3a0, 0x1f3ca, 2},
+	{0x1f3cf, 0x1f3d3, 2}, {0x1f3e0, 0x1f3f0, 2}, {0x1f3f4, 0x1f3f4, 2}, {0x1f3f8, 0x1f43e, 2},
+	{0x1f440, 0x1f440, 2}, {0x1f442, 0x1f4fc, 2}, {0x1f4ff, 0x1f53d, 2}, {0x1f54b, 0x1f54e, 2},
+	{0x1f550, 0x1f567, 2}, {0x1f57a, 0x1f57a, 2}, {0x1f595, 0x1f596, 2}, {0x1f5a4, 0x1f5a4, 2},
+	{0x1f5fb, 0x1f64f, 2}, {0x1f680, 0x1f6c5, 2}, {0x1f6cc, 0x1f6cc, 2}, {0x1f6d0, 0x1f6d2, 2},
+	{0x1f6d5, 0x1f6d7, 2}, {0x1f6dc, 0x1f6df, 2}, {0x1f6eb, 0x1f6ec, 2}, {0x1f6f4, 0x1f6fc, 2},
+	{0x1f7e0, 0x1f7eb, 2}, {0x1f90c, 0x1f93a, 2}, {0x1f93c, 0x1f945, 2}, {0x1f947, 0x1f9ff, 2},
+	{0x1fa70, 0x1faff, 2}, {0x20000, 0x2fffd, 2}, {0x30000, 0x3fffd, 2},
+}
+
+// East Asian Ambiguous, the parts of it likely to show up in a label
+var ambiguousGlyphs = []glyphRange{
+	{0x00a1, 0x00a1, 1}, {0x00a4, 0x00a4, 1}, {0x00a7, 0x00a8, 1}, {0x00aa, 0x00aa, 1},
+	{0x00ad, 0x00ae, 1}, {0x00b0, 0x00b4, 1}, {0x00b6, 0x00ba, 1}, {0x00bc, 0x00bf, 1},
+	{0x00c6, 0x00c6, 1}, {0x00d0, 0x00d0, 1}, {0x00d7, 0x00d8, 1}, {0x00de, 0x00e1, 1},
+	{0x00e6, 0x00e6, 1}, {0x00e8, 0x00ea, 1}, {0x00ec, 0x00ed, 1}, {0x00f0, 0x00f0, 1},
+	{0x00f2, 0x00f3, 1}, {0x00f7, 0x00fa, 1}, {0x00fc, 0x00fc, 1}, {0x00fe, 0x00fe, 1},
+	{0x0391, 0x03a9, 1}, {0x03b1, 0x03c9, 1}, {0x0401, 0x0401, 1}, {0x0410, 0x044f, 1},
+	{0x0451, 0x0451, 1}, {0x2010, 0x2010, 1}, {0x2013, 0x2016, 1}, {0x2018, 0x2019, 1},
+	{0x201c, 0x201d, 1}, {0x2020, 0x2022, 1}, {0x2024, 0x2027, 1}, {0x2030, 0x2030, 1},
+	{0x2032, 0x2033, 1}, {0x2035, 0x2035, 1}, {0x203b, 0x203b, 1}, {0x203e, 0x203e, 1},
+	{0x2103, 0x2103, 1}, {0x2109, 0x2109, 1}, {0x2116, 0x2116, 1}, {0x2121, 0x2122, 1},
+	{0x2160, 0x216b, 1}, {0x2170, 0x2179, 1}, {0x2190, 0x2199, 1}, {0x21d2, 0x21d2, 1},
+	{0x21d4, 0x21d4, 1}, {0x2200, 0x22ff, 1}, {0x2460, 0x24e9, 1}, {0x24eb, 0x254b, 1},
+	{0x2550, 0x2573, 1}, {0x2580, 0x258f, 1}, {0x2592, 0x2595, 1}, {0x25a0, 0x25a1, 1},
+	{0x25a3, 0x25a9, 1}, {0x25b2, 0x25b3, 1}, {0x25b6, 0x25b7, 1}, {0x25bc, 0x25bd, 1},
+	{0x25c0, 0x25c1, 1}, {0x25c6, 0x25c8, 1}, {0x25cb, 0x25cb, 1}, {0x25ce, 0x25d1, 1},
+	{0x25e2, 0x25e5, 1}, {0x25ef, 0x25ef, 1}, {0x2605, 0x2606, 1}, {0x2609, 0x2609, 1},
+	{0x260e, 0x260f, 1}, {0x261c, 0x261c, 1}, {0x261e, 0x261e, 1}, {0x2640, 0x2640, 1},
+	{0x2642, 0x2642, 1}, {0x2660, 0x2661, 1}, {0x2663, 0x2665, 1}, {0x2667, 0x266a, 1},
+	{0x266c, 0x266d, 1}, {0x266f, 0x266f, 1}, {0x273d, 0x273d, 1}, {0x2776, 0x277f, 1},
+	{0xfffd, 0xfffd, 1},
+}
+
+var privateGlyphs = []glyphRange{
+	{0xe000, 0xf8ff, 1}, {0xf0000, 0xffffd, 1}, {0x100000, 0x10fffd, 1},
+}
+
+func findGlyph(table []glyphRange, r rune) (glyphRange, bool) {
+	for _, g := range table {
+		if r >= g.lo && r <= g.hi {
+			return g, true
+		}
+	}
+	return glyphRange{}, false
+}
+
+// applyGlyphWidth parses `ambiguous=N', `private=N', `U+XXXX=N' or
+// `U+XXXX-U+YYYY=N'
+func applyGlyphWidth(val string) error {
+	name, num, ok := strings.Cut(val, "=")
+	if !ok {
+		return fmt.Errorf("not in proper format (eg U+E000-U+F8FF=2)")
+	}
+	width, err := strconv.Atoi(num)
+	if err != nil || width < 0 || width > 2 {
+		return fmt.Errorf("width `%s' must be 0, 1 or 2", num)
+	}
+
+	switch strings.ToLower(name) {
+	case "ambiguous":
+		ambiguousWidth = width
+		return nil
+	case "private":
+		privateWidth = width
+		return nil
+	}
+
+	parseRune := func(s string) (rune, error) {
+		s = strings.TrimPrefix(strings.ToUpper(s), "U+")
+		n, err := strconv.ParseUint(s, 16, 32)
+		if err != nil || n > unicode.MaxRune {
+			return 0, fmt.Errorf("code point `%s' doesn't exist", s)
+		}
+		return rune(n), nil
+	}
+	lo, hi, isRange := strings.Cut(name, "-")
+	from, err := parseRune(lo)
+	if err != nil {
+		return err
+	}
+	to := from
+	if isRange {
+		if to, err = parseRune(hi); err != nil {
+			return err
+		}
+	}
+	glyphWidths = append([]glyphRange{{from, to, width}}, glyphWidths...)
+	return nil
+}
+
+func runeWidth(r rune) int {
+	if g, ok := findGlyph(glyphWidths, r); ok {
+		return g.width
+	}
+	switch {
+	case r < 0x20, r >= 0x7f && r < 0xa0:
+		return 0
+	case r < 0xa1:
+		return 1
+	case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.Is(unicode.Cf, r):
+		return 0
+	}
+	if _, ok := findGlyph(wideGlyphs, r); ok {
+		return 2
+	}
+	if _, ok := findGlyph(privateGlyphs, r); ok {
+		return privateWidth
+	}
+	if _, ok := findGlyph(ambiguousGlyphs, r); ok {
+		return ambiguousWidth
+	}
+	return 1
+}
+
+// extendsCluster reports whether r belongs to the grapheme cluster before
+// it rather than starting a new one
+func extendsCluster(prev, r rune) bool {
+	switch {
+	case prev == 0x200d:
+		// Zero-width joiner glues emoji sequences together
+		return true
+	case r == 0x200d, r >= 0xfe00 && r <= 0xfe0f, r >= 0xe0100 && r <= 0xe01ef:
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f:
+		// Skin tones and flag tags
+		return true
+	case r >= 0x1160 && r <= 0x11ff, r >= 0xd7b0 && r <= 0xd7ff:
+		// Hangul vowels and trailing consonants
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// graphemes calls fn with each grapheme cluster in the text and the number
+// of columns it takes up, stopping early when fn returns false
+func graphemes(text string, fn func(cluster string, width int) bool) {
+	start := 0
+	width := 0
+	var prev rune
+	regional := false
+	for i, r := range text {
+		isRegional := r >= 0x1f1e6 && r <= 0x1f1ff
+		switch {
+		case i == 0:
+		case isRegional && regional:
+			// The second half of a flag
+			regional = false
+			prev = r
+			continue
+		case extendsCluster(prev, r):
+			if r == 0xfe0f {
+				// Emoji presentation
+				width = 2
+			}
+			prev = r
+			continue
+		default:
+			if !fn(text[start:i], width) {
+				return
+			}
+			start = i
+		}
+		width = runeWidth(r)
+		regional = isRegional
+		if isRegional {
+			width = 2
+		}
+		prev = r
+	}
+	if start < len(text) {
+		fn(text[start:], width)
+	}
+}
+
+func visibleWidth(text string) int {
+	n := 0
+	graphemes(text, func(_ string, width int) bool {
+		n += width
+		return true
+	})
+	return n
+}
+
+// truncateSegments cuts the segments down to the width, ending on an
+// ellipsis when anything was dropped
+func truncateSegments(segs []Segment, width int) []Segment {
+	if visibleWidth(segmentsText(segs)) <= width {
+		return segs
+	} else if width <= 0 {
+		return nil
+	}
+
+	ret := []Segment{}
+	left := width - visibleWidth("…")
+	for _, seg := range segs {
+		text := ""
+		full := true
+		graphemes(seg.Text, func(cluster string, n int) bool {
+			if n > left {
+				full = false
+				return false
+			}
+			text += cluster
+			left -= n
+			return true
+		})
+
+		if !full {
+			seg.Text = text + "…"
+			return append(ret, seg)
+		}
+		ret = append(ret, seg)
+	}
+	return ret
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// withGlyphWidths applies the -glyph-width values for the rest of the test
+func withGlyphWidths(t *testing.T, vals ...string) {
+	t.Helper()
+	oldAmbiguous, oldPrivate, oldGlyphs := ambiguousWidth, privateWidth, glyphWidths
+	t.Cleanup(func() {
+		ambiguousWidth, privateWidth, glyphWidths = oldAmbiguous, oldPrivate, oldGlyphs
+	})
+	for _, val := range vals {
+		if err := applyGlyphWidth(val); err != nil {
+			t.Fatalf("%s: %s", val, err)
+		}
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		text   string
+		widths []string
+		want   int
+	}{
+		{"ascii", "Ctrl", nil, 4},
+		{"empty", "", nil, 0},
+		{"control", "a\x1bb", nil, 2},
+		{"kanji", "日本語", nil, 6},
+		{"hangul", "한국", nil, 4},
+		{"jamo", "\u1100\u1161\u11a8", nil, 2},
+		{"fullwidth", "ＡＢ", nil, 4},
+		{"mixed", "a日b", nil, 4},
+		{"combining accent", "e\u0301", nil, 1},
+		{"emoji", "👍", nil, 2},
+		{"skin tone", "👍🏽", nil, 2},
+		{"zwj family", "👨\u200d👩\u200d👧", nil, 2},
+		{"zwj profession", "🧑\u200d💻", nil, 2},
+		{"emoji presentation", "\u2764\ufe0f", nil, 2},
+		{"text presentation", "\u2764", nil, 1},
+		{"flag", "🇯🇵", nil, 2},
+		{"two flags", "🇯🇵🇫🇷", nil, 4},
+		{"emoji among text", "a👨\u200d👩\u200d👧b", nil, 4},
+		{"ambiguous", "→←", nil, 2},
+		{"ambiguous wide", "→←", []string{"ambiguous=2"}, 4},
+		{"greek ambiguous wide", "αβ", []string{"ambiguous=2"}, 4},
+		{"private use", "\ue0b0\uf023", nil, 2},
+		{"private use wide", "\ue0b0\uf023", []string{"private=2"}, 4},
+		{"supplementary private use", "\U000f0001", []string{"private=2"}, 2},
+		{"override one glyph", "\ue0b0\uf023", []string{"U+E0B0=2"}, 3},
+		{"override a range", "←→a", []string{"U+2190-U+2199=2"}, 5},
+		{"override beats ambiguous", "→", []string{"ambiguous=2", "u+2192=1"}, 1},
+		{"override to zero", "a\u00adb", []string{"U+00AD=0"}, 2},
+		{"override a wide glyph", "日", []string{"U+65E5=1"}, 1},
+		{"later override wins", "\ue0b0", []string{"U+E000-U+F8FF=2", "U+E0B0=1"}, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withGlyphWidths(t, tt.widths...)
+			if got := visibleWidth(tt.text); got != tt.want {
+				t.Errorf("visibleWidth(%+q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyGlyphWidthErrors(t *testing.T) {
+	for _, val := range []string{
+		"ambiguous", "ambiguous=3", "private=-1", "private=wide",
+		"U+ZZZZ=1", "U+110000=1", "U+E000-nope=2", "=1",
+	} {
+		t.Run(val, func(t *testing.T) {
+			withGlyphWidths(t)
+			if err := applyGlyphWidth(val); err == nil {
+				t.Errorf("applyGlyphWidth(%q) succeeded", val)
+			}
+			if ambiguousWidth != 1 || privateWidth != 1 || len(glyphWidths) != 0 {
+				t.Errorf("applyGlyphWidth(%q) changed the widths", val)
+			}
+		})
+	}
+}
+
+func TestFitChips(t *testing.T) {
+	format := func(key Key) (string, int) {
+		return key.Char, visibleWidth(key.Char)
+	}
+	snap := func(labels ...string) []Key {
+		keys := []Key{}
+		for _, label := range labels {
+			keys = append(keys, Key{Char: label})
+		}
+		return keys
+	}
+
+	for _, tt := range []struct {
+		name   string
+		snap   []Key
+		width  int
+		sep    string
+		widths []string
+		want   string
+		wantN  int
+	}{
+		{"all fit", snap("日本", "a", "👍"), 10, " ", nil, "日本 a 👍", 9},
+		{"exactly full drops the oldest", snap("日本", "a", "👍"), 9, " ", nil, "a 👍", 4},
+		{"nothing fits", snap("日本", "a", "👍"), 2, " ", nil, "", 0},
+		{"wide separator", snap("a", "b", "c"), 8, "│", []string{"U+2502=2"}, "a│b│c", 7},
+		{"zwj chips", snap("👨\u200d👩\u200d👧", "🧑\u200d💻", "x"), 7, " ", nil, "🧑\u200d💻 x", 4},
+		{"ambiguous arrows", snap("→", "←", "↑"), 6, " ", []string{"ambiguous=2"}, "← ↑", 5},
+		{"private glyphs", snap("\ue0b0", "\ue0b1", "\ue0b2"), 6, " ", nil, "\ue0b0 \ue0b1 \ue0b2", 5},
+		{"private glyphs wide", snap("\ue0b0", "\ue0b1", "\ue0b2"), 6, " ", []string{"private=2"}, "\ue0b1 \ue0b2", 5},
+		{"placeholders skipped", snap("a", "\x00", "b"), 10, " ", nil, "a b", 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withGlyphWidths(t, tt.widths...)
+			got, n := fitChips(tt.snap, tt.width, tt.sep, format)
+			if got != tt.want || n != tt.wantN {
+				t.Errorf("fitChips = %+q, %d; want %+q, %d", got, n, tt.want, tt.wantN)
+			}
+			if n != visibleWidth(got) {
+				t.Errorf("reported width %d, but %+q takes %d", n, got, visibleWidth(got))
+			}
+		})
+	}
+
+	// Every chip that's dropped is older than every chip that's kept
+	chips, _ := fitChipList(snap("a", "b", "c", "d"), 6, 1, format)
+	if !slices.Equal(chips, []string{"d", "c", "b"}) {
+		t.Errorf("fitChipList = %q, want newest first [d c b]", chips)
+	}
+}